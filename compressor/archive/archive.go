@@ -0,0 +1,471 @@
+// Package archive stores many files, each compressed with the huffman
+// package, in a single archive with a central directory at its end.
+package archive
+
+import (
+	"bufio"
+	"compressor/huffman"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// An archive is laid out as follows, with all integers big-endian:
+//
+//	magic     [4]byte  "HUFA"
+//	version   uint8    formatVersion
+//	data      ...      a huffman stream for every regular file, back to back
+//	directory ...      see below
+//	offset    uint64   file offset of the directory
+//	magic     [4]byte  "HUFA" again, marking a complete archive
+//
+// The directory is a uint32 entry count followed by, for every entry:
+//
+//	name      uint16 length and that many bytes, a slash-separated relative path
+//	mode      uint32   fs.FileMode bits
+//	mtime     int64    modification time in nanoseconds since the Unix epoch
+//	size      uint64   length of the original file
+//	offset    uint64   file offset of the entry's huffman stream
+//	length    uint64   length of the huffman stream, zero for a directory
+var magic = [4]byte{'H', 'U', 'F', 'A'}
+
+const formatVersion uint8 = 1
+
+// headerSize and footerSize are the lengths of the leading magic number and
+// version, and of the trailing directory offset and magic number.
+const (
+	headerSize = 5
+	footerSize = 12
+)
+
+var (
+	// ErrFormat is returned when the input is not a complete archive.
+	ErrFormat = errors.New("archive: not an archive")
+
+	// ErrVersion is returned when the archive uses an unsupported version.
+	ErrVersion = errors.New("archive: unsupported format version")
+
+	// ErrHeader is returned when the central directory is invalid.
+	ErrHeader = errors.New("archive: invalid central directory")
+
+	// ErrUnsafePath is returned for entry names that would be extracted
+	// outside the target directory.
+	ErrUnsafePath = errors.New("archive: unsafe entry name")
+)
+
+// An Entry describes one file or directory in an archive.
+type Entry struct {
+	Name    string
+	Mode    fs.FileMode
+	ModTime time.Time
+	Size    int64
+
+	// CompressedSize is the length of the entry's huffman stream.
+	CompressedSize int64
+
+	offset int64
+}
+
+// countingWriter counts the bytes written through it, which gives the offset
+// of every entry.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// A Writer creates an archive. Entries are added with Add or AddPath, and
+// Close writes the central directory.
+type Writer struct {
+	// Skipped lists the paths AddPath left out because they are neither
+	// regular files nor directories, such as symbolic links, devices and
+	// sockets, which an archive has no way to store, or because they are
+	// the archive being written.
+	Skipped []string
+
+	// output describes the archive file when the Writer writes to one, so
+	// AddPath can keep it out of itself.
+	output fs.FileInfo
+
+	w       *bufio.Writer
+	counter *countingWriter
+	huffman *huffman.Writer
+	entries []Entry
+	closed  bool
+}
+
+// NewWriter writes the archive header to w and returns a Writer that
+// compresses every file with the given options. When w is a file, such as an
+// *os.File, AddPath skips it wherever it turns up.
+func NewWriter(w io.Writer, options huffman.WriterOptions) (*Writer, error) {
+
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counter)
+
+	compressor, err := huffman.NewWriterOptions(buffered, options)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered.Write(magic[:])
+	if err := buffered.WriteByte(formatVersion); err != nil {
+		return nil, err
+	}
+
+	z := &Writer{w: buffered, counter: counter, huffman: compressor}
+	if file, ok := w.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			z.output = info
+		}
+	}
+
+	return z, nil
+}
+
+// offset returns the archive offset of the next byte to be written.
+func (z *Writer) offset() int64 {
+	return z.counter.n + int64(z.w.Buffered())
+}
+
+// Add adds an entry named name described by info. The contents of a regular
+// file are read from r; for a directory r is ignored.
+func (z *Writer) Add(name string, info fs.FileInfo, r io.Reader) error {
+
+	if !fs.ValidPath(name) || name == "." {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, name)
+	}
+	if len(name) > 1<<16-1 {
+		return fmt.Errorf("archive: entry name of %d bytes is too long", len(name))
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return fmt.Errorf("archive: %s is neither a regular file nor a directory", name)
+	}
+
+	entry := Entry{
+		Name:    name,
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		offset:  z.offset(),
+	}
+
+	if info.Mode().IsRegular() {
+		z.huffman.Reset(z.w)
+		size, err := io.Copy(z.huffman, r)
+		if err != nil {
+			return err
+		}
+		if err := z.huffman.Close(); err != nil {
+			return err
+		}
+		entry.Size = size
+		entry.CompressedSize = z.offset() - entry.offset
+	}
+
+	z.entries = append(z.entries, entry)
+
+	return nil
+}
+
+// AddPath adds the file or directory at filename, recursing into
+// directories. Entries are named after filename when it is a local path such
+// as dir/file, and after its base name otherwise. Symbolic links are not
+// followed: they and any other files that are not regular are recorded in
+// Skipped instead of being added, as is the archive itself.
+func (z *Writer) AddPath(filename string) error {
+
+	root := filepath.Clean(filename)
+	name := filepath.ToSlash(root)
+	if !filepath.IsLocal(root) {
+		name = filepath.Base(root)
+	}
+
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entryName := path.Join(name, filepath.ToSlash(relative))
+		if entryName == "." {
+			// The current directory itself has no name to store.
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return z.Add(entryName, info, nil)
+		}
+		if !info.Mode().IsRegular() || z.output != nil && os.SameFile(info, z.output) {
+			z.Skipped = append(z.Skipped, p)
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return z.Add(entryName, info, file)
+	})
+}
+
+// Close writes the central directory and footer. It does not close the
+// underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+
+	directoryOffset := z.offset()
+
+	if err := binary.Write(z.w, binary.BigEndian, uint32(len(z.entries))); err != nil {
+		return err
+	}
+	for _, entry := range z.entries {
+		if err := writeEntry(z.w, entry); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(z.w, binary.BigEndian, uint64(directoryOffset)); err != nil {
+		return err
+	}
+	if _, err := z.w.Write(magic[:]); err != nil {
+		return err
+	}
+
+	return z.w.Flush()
+}
+
+func writeEntry(w io.Writer, entry Entry) error {
+
+	if err := binary.Write(w, binary.BigEndian, uint16(len(entry.Name))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, entry.Name); err != nil {
+		return err
+	}
+
+	fields := []any{
+		uint32(entry.Mode),
+		entry.ModTime.UnixNano(),
+		uint64(entry.Size),
+		uint64(entry.offset),
+		uint64(entry.CompressedSize),
+	}
+	for _, field := range fields {
+		if err := binary.Write(w, binary.BigEndian, field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A Reader reads an archive. Only the central directory is read when the
+// Reader is created; entry data is read when an entry is opened.
+type Reader struct {
+	r    io.ReaderAt
+	size int64
+
+	// Entries lists the archive's entries in the order they were added.
+	Entries []Entry
+}
+
+// NewReader returns a Reader for the archive of the given size read through
+// r.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+
+	if size < headerSize+4+footerSize {
+		return nil, ErrFormat
+	}
+
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, err
+	}
+	if [4]byte(header[:4]) != magic {
+		return nil, ErrFormat
+	}
+	if header[4] != formatVersion {
+		return nil, fmt.Errorf("%w %d", ErrVersion, header[4])
+	}
+
+	var footer [footerSize]byte
+	if _, err := r.ReadAt(footer[:], size-footerSize); err != nil {
+		return nil, err
+	}
+	if [4]byte(footer[8:]) != magic {
+		return nil, fmt.Errorf("%w: missing footer, the archive may be truncated", ErrFormat)
+	}
+
+	directoryOffset := int64(binary.BigEndian.Uint64(footer[:8]))
+	if directoryOffset < headerSize || directoryOffset > size-footerSize-4 {
+		return nil, fmt.Errorf("%w: directory offset %d out of range", ErrHeader, directoryOffset)
+	}
+
+	directory := bufio.NewReader(io.NewSectionReader(r, directoryOffset, size-footerSize-directoryOffset))
+
+	var count uint32
+	if err := binary.Read(directory, binary.BigEndian, &count); err != nil {
+		return nil, noEOF(err)
+	}
+
+	z := &Reader{r: r, size: size}
+	for i := uint32(0); i < count; i++ {
+		entry, err := readEntry(directory)
+		if err != nil {
+			return nil, err
+		}
+		if entry.offset < headerSize || entry.CompressedSize < 0 || entry.offset > directoryOffset-entry.CompressedSize {
+			return nil, fmt.Errorf("%w: entry %q lies outside the archive data", ErrHeader, entry.Name)
+		}
+		z.Entries = append(z.Entries, entry)
+	}
+
+	return z, nil
+}
+
+func readEntry(r io.Reader) (Entry, error) {
+
+	var entry Entry
+
+	var nameLength uint16
+	if err := binary.Read(r, binary.BigEndian, &nameLength); err != nil {
+		return entry, noEOF(err)
+	}
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return entry, noEOF(err)
+	}
+	entry.Name = string(name)
+
+	var fields struct {
+		Mode           uint32
+		ModTime        int64
+		Size           uint64
+		Offset         uint64
+		CompressedSize uint64
+	}
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return entry, noEOF(err)
+	}
+
+	entry.Mode = fs.FileMode(fields.Mode)
+	entry.ModTime = time.Unix(0, fields.ModTime)
+	entry.Size = int64(fields.Size)
+	entry.offset = int64(fields.Offset)
+	entry.CompressedSize = int64(fields.CompressedSize)
+
+	return entry, nil
+}
+
+// Open returns a reader for the contents of a regular file entry.
+func (z *Reader) Open(entry Entry) (io.Reader, error) {
+	if !entry.Mode.IsRegular() {
+		return nil, fmt.Errorf("archive: %s is not a regular file", entry.Name)
+	}
+	return huffman.NewReader(io.NewSectionReader(z.r, entry.offset, entry.CompressedSize))
+}
+
+// Extract writes every entry below dir, restoring permissions and
+// modification times. Entry names that are not local paths are rejected, so
+// nothing is written outside dir.
+func (z *Reader) Extract(dir string) error {
+
+	for _, entry := range z.Entries {
+		if !fs.ValidPath(entry.Name) || !filepath.IsLocal(filepath.FromSlash(entry.Name)) {
+			return fmt.Errorf("%w: %q", ErrUnsafePath, entry.Name)
+		}
+	}
+
+	for _, entry := range z.Entries {
+		target := filepath.Join(dir, filepath.FromSlash(entry.Name))
+
+		if entry.Mode.IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := z.extractFile(entry, target); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name, err)
+		}
+	}
+
+	// Directories get their own permissions and times last, since creating
+	// their contents would change the times and might need write access.
+	for i := len(z.Entries) - 1; i >= 0; i-- {
+		entry := z.Entries[i]
+		if !entry.Mode.IsDir() {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if err := os.Chmod(target, entry.Mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, entry.ModTime, entry.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *Reader) extractFile(entry Entry, target string) error {
+
+	reader, err := z.Open(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return err
+	}
+	if err := file.Chmod(entry.Mode.Perm()); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
+
+// noEOF turns a clean end of input into io.ErrUnexpectedEOF, since the
+// directory ends before its last entry.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,292 @@
+package archive
+
+import (
+	"bytes"
+	"compressor/huffman"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// chdir changes the working directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	files := map[string]string{
+		"tree/a.txt":         "the first file\n",
+		"tree/empty":         "",
+		"tree/sub/b.txt":     string(bytes.Repeat([]byte("compressed with huffman codes "), 1000)),
+		"tree/sub/deep/c.go": "package deep\n",
+		"single.txt":         "added on its own",
+	}
+	writeTree(t, source, files)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(source, "tree", "sub"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(source, "tree", "a.txt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, huffman.WriterOptions{Method: huffman.MethodLZ})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, source)
+	for _, filename := range []string{"tree", filepath.Join(source, "single.txt")} {
+		if err := writer.AddPath(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range reader.Entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"tree", "tree/a.txt", "tree/empty", "tree/sub", "tree/sub/b.txt", "tree/sub/deep", "tree/sub/deep/c.go", "single.txt"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("entries %v, expected %v", names, expected)
+	}
+
+	target := t.TempDir()
+	if err := reader.Extract(target); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contents := range files {
+		data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != contents {
+			t.Errorf("%s: extracted %d bytes, expected %d", name, len(data), len(contents))
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(target, "tree", "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("tree/a.txt extracted with mode %v, expected %v", info.Mode().Perm(), fs.FileMode(0o600))
+	}
+
+	info, err = os.Stat(filepath.Join(target, "tree", "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("tree/sub extracted with mtime %v, expected %v", info.ModTime(), modTime)
+	}
+}
+
+// TestAddPathSkipsSymlinks checks that symbolic links in a tree, whether to
+// a file, a directory or nothing, are skipped rather than failing the
+// archive, and that the rest of the tree still extracts.
+func TestAddPathSkipsSymlinks(t *testing.T) {
+	source := t.TempDir()
+	writeTree(t, source, map[string]string{"tree/a.txt": "a regular file\n", "tree/sub/b.txt": "another\n"})
+	links := map[string]string{"tree/to-file": "a.txt", "tree/to-dir": "sub", "tree/dangling": "missing"}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(source, filepath.FromSlash(name))); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, huffman.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdir(t, source)
+	if err := writer.AddPath("tree"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.Skipped) != len(links) {
+		t.Errorf("skipped %v, expected the %d links", writer.Skipped, len(links))
+	}
+
+	reader, err := NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range reader.Entries {
+		names = append(names, entry.Name)
+	}
+	if expected := []string{"tree", "tree/a.txt", "tree/sub", "tree/sub/b.txt"}; fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("entries %v, expected %v", names, expected)
+	}
+	if err := reader.Extract(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddPathSkipsArchive checks that an archive created inside the
+// directory it archives leaves itself out.
+func TestAddPathSkipsArchive(t *testing.T) {
+	source := t.TempDir()
+	writeTree(t, source, map[string]string{"a.txt": "a regular file\n", "sub/b.txt": "another\n"})
+	chdir(t, source)
+
+	output, err := os.Create("out.arc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+
+	writer, err := NewWriter(output, huffman.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.AddPath("."); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(writer.Skipped) != "[out.arc]" {
+		t.Errorf("skipped %v, expected [out.arc]", writer.Skipped)
+	}
+
+	info, err := output.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(output, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range reader.Entries {
+		names = append(names, entry.Name)
+	}
+	if expected := []string{"a.txt", "sub", "sub/b.txt"}; fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("entries %v, expected %v", names, expected)
+	}
+}
+
+// dataGuard fails reads below limit, standing in for entry data that must
+// not be touched.
+type dataGuard struct {
+	r     io.ReaderAt
+	limit int64
+}
+
+func (g dataGuard) ReadAt(p []byte, off int64) (int, error) {
+	if off > headerSize && off < g.limit {
+		return 0, fmt.Errorf("read of entry data at offset %d", off)
+	}
+	return g.r.ReadAt(p, off)
+}
+
+// TestListReadsOnlyDirectory checks that NewReader finds the entries through
+// the central directory without reading any entry data.
+func TestListReadsOnlyDirectory(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, huffman.WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"big.txt": {Data: bytes.Repeat([]byte("x"), 100000), Mode: 0o644}}
+	info, _ := fs.Stat(fsys, "big.txt")
+	if err := writer.Add("big.txt", info, bytes.NewReader(fsys["big.txt"].Data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dataEnd := int64(headerSize) + writer.entries[0].CompressedSize
+	guard := dataGuard{r: bytes.NewReader(buffer.Bytes()), limit: dataEnd}
+
+	reader, err := NewReader(guard, int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.Entries) != 1 || reader.Entries[0].Size != 100000 {
+		t.Errorf("entries %+v", reader.Entries)
+	}
+}
+
+func TestReaderRejectsDamagedArchives(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, _ := NewWriter(&buffer, huffman.WriterOptions{})
+	fsys := fstest.MapFS{"file": {Data: []byte("contents"), Mode: 0o644}}
+	info, _ := fs.Stat(fsys, "file")
+	writer.Add("file", info, bytes.NewReader(fsys["file"].Data))
+	writer.Close()
+	archive := buffer.Bytes()
+
+	truncated := archive[:len(archive)-1]
+	if _, err := NewReader(bytes.NewReader(truncated), int64(len(truncated))); !errors.Is(err, ErrFormat) {
+		t.Errorf("truncated archive: error = %v, expected %v", err, ErrFormat)
+	}
+
+	notArchive := []byte("definitely not an archive of any kind")
+	if _, err := NewReader(bytes.NewReader(notArchive), int64(len(notArchive))); !errors.Is(err, ErrFormat) {
+		t.Errorf("not an archive: error = %v, expected %v", err, ErrFormat)
+	}
+}
+
+func TestUnsafeNames(t *testing.T) {
+	var buffer bytes.Buffer
+	writer, _ := NewWriter(&buffer, huffman.WriterOptions{})
+	fsys := fstest.MapFS{"file": {Data: []byte("contents"), Mode: 0o644}}
+	info, _ := fs.Stat(fsys, "file")
+
+	for _, name := range []string{"../escape", "/absolute", "a/../../b", "."} {
+		if err := writer.Add(name, info, bytes.NewReader(nil)); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("Add(%q) error = %v, expected %v", name, err, ErrUnsafePath)
+		}
+	}
+
+	// A crafted archive with an escaping name must not be extracted.
+	reader := &Reader{Entries: []Entry{{Name: "../escape", Mode: 0o644}}}
+	if err := reader.Extract(t.TempDir()); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("Extract error = %v, expected %v", err, ErrUnsafePath)
+	}
+}
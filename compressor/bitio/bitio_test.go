@@ -0,0 +1,200 @@
+package bitio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// randomCodes returns n codes of 1 to 24 bits.
+func randomCodes(n int) []Code {
+	random := rand.New(rand.NewSource(1))
+	codes := make([]Code, n)
+	for i := range codes {
+		length := uint(1 + random.Intn(24))
+		codes[i] = Code{Bits: random.Uint64() & (1<<length - 1), Length: length}
+	}
+	return codes
+}
+
+func TestRoundTrip(t *testing.T) {
+	codes := randomCodes(10000)
+
+	var buffer bytes.Buffer
+	bw := NewWriter(&buffer)
+	for _, code := range codes {
+		bw.WriteCode(code)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading a byte at a time makes every chunk boundary fall mid-code.
+	for name, r := range map[string]io.Reader{
+		"whole":    bytes.NewReader(buffer.Bytes()),
+		"one byte": iotest.OneByteReader(bytes.NewReader(buffer.Bytes())),
+	} {
+		br := NewReader(r)
+		for i, code := range codes {
+			bits, err := br.ReadBits(code.Length)
+			if err != nil {
+				t.Fatalf("%s: code %d: %v", name, i, err)
+			}
+			if bits != code.Bits {
+				t.Fatalf("%s: code %d is %0*b, expected %0*b", name, i, code.Length, bits, code.Length, code.Bits)
+			}
+		}
+	}
+}
+
+func TestWriterBitOrder(t *testing.T) {
+	var msb, lsb bytes.Buffer
+
+	bw := NewWriter(&msb)
+	bw.WriteBits(0b101, 3)
+	bw.WriteBits(0b1, 1)
+	bw.Flush()
+
+	bw = NewLSBWriter(&lsb)
+	bw.WriteBits(0b101, 3)
+	bw.WriteBits(0b1, 1)
+	bw.Flush()
+
+	if !bytes.Equal(msb.Bytes(), []byte{0b10110000}) {
+		t.Errorf("MSB-first writer wrote %08b", msb.Bytes())
+	}
+	if !bytes.Equal(lsb.Bytes(), []byte{0b00001101}) {
+		t.Errorf("LSB-first writer wrote %08b", lsb.Bytes())
+	}
+}
+
+func TestReaderEnd(t *testing.T) {
+	br := NewReader(bytes.NewReader([]byte{0xff}))
+
+	if bits, err := br.ReadBits(8); bits != 0xff || err != nil {
+		t.Fatalf("ReadBits = %#x, %v", bits, err)
+	}
+	if _, err := br.ReadBits(1); err != io.ErrUnexpectedEOF {
+		t.Errorf("reading past the end returned %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+
+	errBroken := errors.New("broken reader")
+	br = NewReader(iotest.ErrReader(errBroken))
+	if _, err := br.ReadBits(1); err != errBroken {
+		t.Errorf("reading a broken reader returned %v, expected %v", err, errBroken)
+	}
+}
+
+func TestReaderOverrun(t *testing.T) {
+	br := NewReader(bytes.NewReader([]byte{0xff, 0xff}))
+
+	if _, err := br.ReadBits(58); err != ErrOverrun {
+		t.Errorf("ReadBits(58) returned %v, expected %v", err, ErrOverrun)
+	}
+
+	br.Fill()
+	buffered := br.Buffered()
+	if err := br.Consume(buffered + 1); err != ErrOverrun {
+		t.Errorf("consuming %d of %d bits returned %v, expected %v", buffered+1, buffered, err, ErrOverrun)
+	}
+	if bits, err := br.ReadBits(16); bits != 0xffff || err != nil {
+		t.Errorf("after an overrun ReadBits = %#x, %v", bits, err)
+	}
+}
+
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestWriterError(t *testing.T) {
+	bw := NewWriter(failingWriter{})
+	for i := 0; i < 2*bufferSize; i++ {
+		bw.WriteBits(uint64(i), 8)
+	}
+	if err := bw.Flush(); err != errWrite {
+		t.Errorf("Flush returned %v, expected %v", err, errWrite)
+	}
+}
+
+// BenchmarkWriteCodes compares packing codes held as integers with the
+// string codes, one "0" or "1" per bit, that the package replaces.
+func BenchmarkWriteCodes(b *testing.B) {
+	codes := randomCodes(1 << 16)
+
+	b.Run("strings", func(b *testing.B) {
+		strs := make([]string, len(codes))
+		for i, code := range codes {
+			binary := strconv.FormatUint(code.Bits, 2)
+			strs[i] = strings.Repeat("0", int(code.Length)-len(binary)) + binary
+		}
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			var output bytes.Buffer
+			var currentByte byte
+			bitIndex := 0
+			for _, code := range strs {
+				for _, codeBit := range code {
+					if codeBit == '1' {
+						currentByte |= 1 << (7 - bitIndex)
+					}
+					bitIndex++
+					if bitIndex == 8 {
+						output.WriteByte(currentByte)
+						currentByte = 0
+						bitIndex = 0
+					}
+				}
+			}
+			if bitIndex > 0 {
+				output.WriteByte(currentByte)
+			}
+		}
+	})
+
+	b.Run("Writer", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			var output bytes.Buffer
+			bw := NewWriter(&output)
+			for _, code := range codes {
+				bw.WriteCode(code)
+			}
+			bw.Flush()
+		}
+	})
+}
+
+func BenchmarkReadBits(b *testing.B) {
+	codes := randomCodes(1 << 16)
+
+	var buffer bytes.Buffer
+	bw := NewWriter(&buffer)
+	for _, code := range codes {
+		bw.WriteCode(code)
+	}
+	bw.Flush()
+
+	b.SetBytes(int64(buffer.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		br := NewReader(bytes.NewReader(buffer.Bytes()))
+		for _, code := range codes {
+			if _, err := br.ReadBits(code.Length); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
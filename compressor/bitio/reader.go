@@ -0,0 +1,124 @@
+package bitio
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrOverrun is returned when more bits are consumed than the buffer holds,
+// or more than 57 are read at once, which would otherwise wrap the count of
+// buffered bits around.
+var ErrOverrun = errors.New("bitio: read past the buffered bits")
+
+// A Reader reads a most-significant-bit-first bitstream from an io.Reader.
+// Bits are buffered in a 64-bit word so that a whole code can be peeked with
+// a single shift.
+type Reader struct {
+	r io.Reader
+
+	// data holds the bytes read ahead from r but not yet moved to buffer.
+	data  []byte
+	chunk []byte
+	err   error
+
+	// buffer holds count unread bits in its low end, the next bit being
+	// bit count-1.
+	buffer uint64
+	count  uint
+
+	// padding counts the zero bits appended to buffer after r ran out,
+	// which may be peeked but never consumed.
+	padding uint
+}
+
+// NewReader returns a Reader that reads bits from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Buffered returns the number of bits that can be peeked without calling
+// Fill, counting any zero padding past the end of the stream.
+func (br *Reader) Buffered() uint {
+	return br.count
+}
+
+// Fill tops the buffer up to at least 57 bits, padding with zeros past the
+// end of the stream.
+func (br *Reader) Fill() {
+	if n := (64 - br.count) / 8; uint(len(br.data)) >= n {
+		for _, b := range br.data[:n] {
+			br.buffer = br.buffer<<8 | uint64(b)
+		}
+		br.data = br.data[n:]
+		br.count += n * 8
+		return
+	}
+
+	for br.count <= 56 {
+		var b byte
+		if len(br.data) > 0 || br.readChunk() {
+			b = br.data[0]
+			br.data = br.data[1:]
+		} else {
+			br.padding += 8
+		}
+		br.buffer = br.buffer<<8 | uint64(b)
+		br.count += 8
+	}
+}
+
+// readChunk reads the next bytes from r into data, reporting whether there
+// were any. The first error ends the stream.
+func (br *Reader) readChunk() bool {
+	if br.chunk == nil {
+		br.chunk = make([]byte, bufferSize)
+	}
+	for br.err == nil {
+		var n int
+		n, br.err = br.r.Read(br.chunk)
+		if n > 0 {
+			br.data = br.chunk[:n]
+			return true
+		}
+	}
+	return false
+}
+
+// Peek returns the next n bits without consuming them. n must be at most 57
+// and Fill must have been called since the last time bits were consumed,
+// unless Buffered reports at least n bits.
+func (br *Reader) Peek(n uint) uint64 {
+	return (br.buffer >> (br.count - n)) & (1<<n - 1)
+}
+
+// Consume discards n bits that have already been peeked. It reports an
+// error if that reaches into the padding past the end of the stream:
+// io.ErrUnexpectedEOF, or the error that ended it if that was not io.EOF.
+// Consuming more bits than are buffered returns ErrOverrun and consumes
+// nothing.
+func (br *Reader) Consume(n uint) error {
+	if n > br.count {
+		return ErrOverrun
+	}
+	br.count -= n
+	if br.count < br.padding {
+		if br.err != nil && br.err != io.EOF {
+			return br.err
+		}
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// ReadBits consumes and returns the next n bits, n being at most 57; more
+// returns ErrOverrun.
+func (br *Reader) ReadBits(n uint) (uint64, error) {
+	if n > 57 {
+		return 0, ErrOverrun
+	}
+	if br.count < n {
+		br.Fill()
+	}
+	bits := br.Peek(n)
+	return bits, br.Consume(n)
+}
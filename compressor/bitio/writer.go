@@ -0,0 +1,108 @@
+// Package bitio reads and writes bitstreams, with codes held as integer bits
+// and a length rather than as strings of binary digits.
+package bitio
+
+import (
+	"io"
+)
+
+// bufferSize is the number of whole bytes a Writer collects, and a Reader
+// reads ahead, between calls to the underlying writer or reader.
+const bufferSize = 4096
+
+// A Code is a prefix code: its Length low bits, most significant first.
+type Code struct {
+	Bits   uint64
+	Length uint
+}
+
+// A Writer packs a bitstream onto an io.Writer. By default bits fill each
+// byte from the most significant end, the counterpart of Reader; DEFLATE
+// streams fill bytes from the least significant end instead.
+//
+// Whole bytes are buffered and passed on in chunks. The first error from the
+// underlying writer is kept and returned by Flush, so the calls that append
+// bits need no error checks.
+type Writer struct {
+	w        io.Writer
+	lsbFirst bool
+
+	// bits holds count pending bits: in its low end when writing the most
+	// significant bit first, and from bit zero up otherwise.
+	bits  uint64
+	count uint
+
+	buffer []byte
+	err    error
+}
+
+// NewWriter returns a Writer that fills bytes starting with their most
+// significant bit.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, buffer: make([]byte, 0, bufferSize)}
+}
+
+// NewLSBWriter returns a Writer that fills bytes starting with their least
+// significant bit, as DEFLATE does.
+func NewLSBWriter(w io.Writer) *Writer {
+	return &Writer{w: w, lsbFirst: true, buffer: make([]byte, 0, bufferSize)}
+}
+
+// WriteBits appends the low n bits of value, n being at most 56. In LSB-first
+// mode the value's own least significant bit goes first.
+func (bw *Writer) WriteBits(value uint64, n uint) {
+	value &= 1<<n - 1
+
+	if bw.lsbFirst {
+		bw.bits |= value << bw.count
+		bw.count += n
+		for bw.count >= 8 {
+			bw.writeByte(byte(bw.bits))
+			bw.bits >>= 8
+			bw.count -= 8
+		}
+		return
+	}
+
+	bw.bits = bw.bits<<n | value
+	bw.count += n
+	for bw.count >= 8 {
+		bw.count -= 8
+		bw.writeByte(byte(bw.bits >> bw.count))
+	}
+}
+
+// WriteCode appends code, most significant bit first in either mode.
+func (bw *Writer) WriteCode(code Code) {
+	bw.WriteBits(code.Bits, code.Length)
+}
+
+func (bw *Writer) writeByte(b byte) {
+	bw.buffer = append(bw.buffer, b)
+	if len(bw.buffer) == cap(bw.buffer) {
+		bw.flushBuffer()
+	}
+}
+
+func (bw *Writer) flushBuffer() {
+	if bw.err == nil && len(bw.buffer) > 0 {
+		_, bw.err = bw.w.Write(bw.buffer)
+	}
+	bw.buffer = bw.buffer[:0]
+}
+
+// Flush pads the last partial byte with zero bits and writes out everything
+// buffered. It returns the first error met by the underlying writer.
+func (bw *Writer) Flush() error {
+	if bw.count > 0 {
+		if bw.lsbFirst {
+			bw.writeByte(byte(bw.bits))
+		} else {
+			bw.writeByte(byte(bw.bits << (8 - bw.count)))
+		}
+		bw.bits = 0
+		bw.count = 0
+	}
+	bw.flushBuffer()
+	return bw.err
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"compressor/archive"
+	"compressor/huffman"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Creates, lists and extracts multi-file archives",
+}
+
+var archiveCreateCmd = &cobra.Command{
+	Use:   "create archive path...",
+	Short: "Compresses files and directories into an archive",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  archiveCreate,
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:   "list archive",
+	Short: "Lists the entries of an archive",
+	Args:  cobra.ExactArgs(1),
+	RunE:  archiveList,
+}
+
+var archiveExtractCmd = &cobra.Command{
+	Use:   "extract archive",
+	Short: "Extracts every entry of an archive",
+	Args:  cobra.ExactArgs(1),
+	RunE:  archiveExtract,
+}
+
+var (
+	archiveMethodName string
+	archiveDirectory  string
+)
+
+func init() {
+	archiveCreateCmd.Flags().StringVar(&archiveMethodName, "method", huffman.MethodHuffman.String(), "compression method for every file")
+	archiveExtractCmd.Flags().StringVarP(&archiveDirectory, "directory", "C", ".", "directory to extract into")
+	archiveCmd.AddCommand(archiveCreateCmd, archiveListCmd, archiveExtractCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
+
+func archiveCreate(cmd *cobra.Command, args []string) error {
+
+	method, err := huffman.ParseMethod(archiveMethodName)
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	writer, err := archive.NewWriter(outputFile, huffman.WriterOptions{Method: method})
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range args[1:] {
+		if err := writer.AddPath(filename); err != nil {
+			return err
+		}
+	}
+	outputInfo, err := outputFile.Stat()
+	if err != nil {
+		return err
+	}
+	for _, filename := range writer.Skipped {
+		if info, err := os.Lstat(filename); err == nil && os.SameFile(info, outputInfo) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: the archive being written, skipped\n", filename)
+			continue
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s: not a regular file or directory, skipped\n", filename)
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return outputFile.Close()
+}
+
+func openArchive(filename string) (*archive.Reader, *os.File, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	reader, err := archive.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return reader, file, nil
+}
+
+func archiveList(cmd *cobra.Command, args []string) error {
+
+	reader, file, err := openArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, entry := range reader.Entries {
+		fmt.Fprintf(w, "%v\t%d\t%d\t %s\t %s\n", entry.Mode, entry.Size, entry.CompressedSize, entry.ModTime.Format(time.DateTime), entry.Name)
+	}
+
+	return w.Flush()
+}
+
+func archiveExtract(cmd *cobra.Command, args []string) error {
+
+	reader, file, err := openArchive(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return reader.Extract(archiveDirectory)
+}
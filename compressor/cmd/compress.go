@@ -2,31 +2,145 @@ package cmd
 
 import (
 	"compressor/huffman"
+	"io"
+	"runtime"
 
 	"github.com/spf13/cobra"
 )
 
 var compressCmd = &cobra.Command{
 	Use:   "compress filename",
-	Short: "Compresses the provided file",
+	Short: "Compresses the provided file, or standard input for -",
 	Args:  cobra.ExactArgs(1),
 	RunE:  compress,
 }
 
-var outputFilename string
+var (
+	outputFilename string
+	maxCodeLength  int
+	blockSize      int
+	jobs           int
+	writeIndex     bool
+	methodName     string
+	windowSize     int
+	formatName     string
+	coderName      string
+	alphabetName   string
+	keepInput      bool
+	forceOverwrite bool
+)
 
 func init() {
-	compressCmd.Flags().StringVarP(&outputFilename, "output", "o", "output.bin", "specify the output file name")
+	compressCmd.Flags().StringVarP(&outputFilename, "output", "o", "", "specify the output file name (default the input name with .huf, or .gz in the gzip format, appended)")
+	compressCmd.Flags().BoolVarP(&writeToStdout, "stdout", "c", false, "write to standard output and keep the input file")
+	compressCmd.Flags().BoolVarP(&keepInput, "keep", "k", false, "keep the input file instead of deleting it")
+	compressCmd.Flags().BoolVarP(&forceOverwrite, "force", "f", false, "overwrite an existing output file")
+	compressCmd.Flags().IntVar(&maxCodeLength, "max-code-length", huffman.DefaultMaxCodeLength, "longest Huffman code to assign, in bits")
+	compressCmd.Flags().IntVar(&blockSize, "block-size", huffman.DefaultBlockSize, "number of input bytes coded with one Huffman table")
+	compressCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.GOMAXPROCS(0), "number of blocks to encode in parallel")
+	compressCmd.Flags().BoolVar(&writeIndex, "index", false, "append a block index for random access with extract")
+	compressCmd.Flags().StringVar(&methodName, "method", huffman.MethodHuffman.String(), "compression method: huffman, adaptive, lz, context or bwt")
+	compressCmd.Flags().IntVar(&windowSize, "window", huffman.DefaultWindowSize, "how far back the lz method looks for matches, in bytes")
+	compressCmd.Flags().StringVar(&coderName, "coder", huffman.CoderHuffman.String(), "entropy coder: huffman or range")
+	compressCmd.Flags().StringVar(&alphabetName, "alphabet", huffman.AlphabetByte.String(), "symbols of the huffman method: byte, rune, word or extended")
+	compressCmd.Flags().StringVar(&formatName, "format", huffman.FormatNative.String(), "output format: native or gzip")
+	compressCmd.MarkFlagsMutuallyExclusive("stdout", "output")
 	rootCmd.AddCommand(compressCmd)
 }
 
 func compress(cmd *cobra.Command, args []string) error {
 	filename := args[0]
 
-	err := huffman.Encode(filename, outputFilename)
+	method, err := huffman.ParseMethod(methodName)
+	if err != nil {
+		return err
+	}
+
+	coder, err := huffman.ParseCoder(coderName)
+	if err != nil {
+		return err
+	}
+
+	alphabet, err := huffman.ParseAlphabet(alphabetName)
+	if err != nil {
+		return err
+	}
+
+	format, err := huffman.ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	options := huffman.WriterOptions{
+		MaxCodeLength: maxCodeLength,
+		BlockSize:     blockSize,
+		Concurrency:   jobs,
+		Index:         writeIndex,
+		Method:        method,
+		Coder:         coder,
+		Alphabet:      alphabet,
+		WindowSize:    windowSize,
+		Format:        format,
+	}
+
+	if filename == stdioName || writeToStdout {
+		return compressStream(cmd, filename, options)
+	}
+
+	output := outputFilename
+	if output == "" {
+		if output, err = compressedName(filename, format); err != nil {
+			return err
+		}
+	}
+	if err := checkOutput(filename, output); err != nil {
+		return err
+	}
+
+	if err := huffman.Encode(filename, output, options); err != nil {
+		return err
+	}
+
+	return removeInput(filename)
+}
+
+// compressStream compresses filename, or standard input, to --output or else
+// to standard output, leaving the input in place. If compression fails, a
+// partial --output file is removed.
+func compressStream(cmd *cobra.Command, filename string, options huffman.WriterOptions) error {
 
+	input, header, err := openInput(cmd, filename)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer input.Close()
+
+	output, err := createOutput(cmd, filename, outputFilename)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if outputFilename == "" && !forceOverwrite && isTerminal(output) {
+		return errTerminal
+	}
+
+	writer, err := huffman.NewWriterOptions(output, options)
+	if err != nil {
+		return discardOutput(output, outputFilename, err)
+	}
+	writer.Header = header
+
+	if _, err := io.Copy(writer, input); err != nil {
+		return discardOutput(output, outputFilename, err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return discardOutput(output, outputFilename, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return discardOutput(output, outputFilename, err)
 	}
 
 	return nil
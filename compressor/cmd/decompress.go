@@ -2,28 +2,105 @@ package cmd
 
 import (
 	"compressor/huffman"
+	"io"
 
 	"github.com/spf13/cobra"
 )
 
 var decompressCmd = &cobra.Command{
 	Use:   "decompress filename",
-	Short: "Decompresses the provided file",
+	Short: "Decompresses the provided file, or standard input for -",
 	Args:  cobra.ExactArgs(1),
 	RunE:  decompress,
 }
 
+var (
+	decompressOutputFilename string
+	maxSize                  int64
+	maxRatio                 int64
+)
+
+// addLimitFlags registers the limits on decompressed data shared by the
+// commands that decompress.
+func addLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&maxSize, "max-size", 0, "stop before any block that would take decompressed data past this many bytes (default no limit)")
+	cmd.Flags().Int64Var(&maxRatio, "max-ratio", 0, "stop when decompressed data exceeds this many times the compressed size (default no limit)")
+}
+
+// addBlockLimitFlags registers the same limits for commands that decode
+// blocks independently, where they apply to each block on its own.
+func addBlockLimitFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(&maxSize, "max-size", 0, "refuse to decode any block of more than this many bytes, however few are extracted (default no limit)")
+	cmd.Flags().Int64Var(&maxRatio, "max-ratio", 0, "refuse to decode any block whose data exceeds this many times its compressed size (default no limit)")
+}
+
+func readerOptions() huffman.ReaderOptions {
+	return huffman.ReaderOptions{MaxSize: maxSize, MaxRatio: maxRatio}
+}
+
 func init() {
+	decompressCmd.Flags().StringVarP(&decompressOutputFilename, "output", "o", "", "specify the output file name (default the input name without its suffix, or the name recorded in it)")
+	decompressCmd.Flags().BoolVarP(&writeToStdout, "stdout", "c", false, "write to standard output and keep the input file")
+	decompressCmd.Flags().BoolVarP(&keepInput, "keep", "k", false, "keep the input file instead of deleting it")
+	decompressCmd.Flags().BoolVarP(&forceOverwrite, "force", "f", false, "overwrite an existing output file")
+	decompressCmd.MarkFlagsMutuallyExclusive("stdout", "output")
+	addLimitFlags(decompressCmd)
 	rootCmd.AddCommand(decompressCmd)
 }
 
 func decompress(cmd *cobra.Command, args []string) error {
 	filename := args[0]
 
-	err := huffman.Decode(filename)
+	if filename == stdioName || writeToStdout {
+		return decompressStream(cmd, filename)
+	}
+
+	output := decompressOutputFilename
+	if output == "" {
+		var err error
+		if output, err = decompressedName(filename); err != nil {
+			return err
+		}
+	}
+	if err := checkOutput(filename, output); err != nil {
+		return err
+	}
+
+	if err := huffman.Decode(filename, output, readerOptions()); err != nil {
+		return err
+	}
 
+	return removeInput(filename)
+}
+
+// decompressStream decompresses filename, or standard input, to --output or
+// else to standard output, leaving the input in place. If decompression
+// fails, a partial --output file is removed, as Decode does.
+func decompressStream(cmd *cobra.Command, filename string) error {
+
+	input, _, err := openInput(cmd, filename)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer input.Close()
+
+	reader, err := huffman.NewReaderOptions(input, readerOptions())
+	if err != nil {
+		return err
+	}
+
+	output, err := createOutput(cmd, filename, decompressOutputFilename)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if _, err := io.Copy(output, reader); err != nil {
+		return discardOutput(output, decompressOutputFilename, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return discardOutput(output, decompressOutputFilename, err)
 	}
 
 	return nil
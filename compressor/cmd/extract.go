@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var extractCmd = &cobra.Command{
+	Use:   "extract filename",
+	Short: "Decompresses a byte range of the provided file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  extract,
+}
+
+var (
+	extractOffset         int64
+	extractLength         int64
+	extractOutputFilename string
+)
+
+func init() {
+	extractCmd.Flags().Int64Var(&extractOffset, "offset", 0, "offset of the first byte to extract")
+	extractCmd.Flags().Int64Var(&extractLength, "length", -1, "number of bytes to extract, or -1 for everything after the offset")
+	extractCmd.Flags().StringVarP(&extractOutputFilename, "output", "o", "", "specify the output file name (default standard output)")
+	extractCmd.Flags().BoolVarP(&forceOverwrite, "force", "f", false, "overwrite an existing output file")
+	addBlockLimitFlags(extractCmd)
+	rootCmd.AddCommand(extractCmd)
+}
+
+func extract(cmd *cobra.Command, args []string) error {
+	filename := args[0]
+
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader, err := huffman.NewReaderAtOptions(inputFile, info.Size(), readerOptions())
+	if err != nil {
+		return err
+	}
+
+	if extractOffset < 0 || extractOffset > reader.Size() {
+		return fmt.Errorf("offset %d is outside the %d bytes of %s", extractOffset, reader.Size(), filename)
+	}
+
+	length := extractLength
+	if length < 0 || length > reader.Size()-extractOffset {
+		length = reader.Size() - extractOffset
+	}
+
+	output, err := createOutput(cmd, filename, extractOutputFilename)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	if _, err := io.Copy(output, io.NewSectionReader(reader, extractOffset, length)); err != nil {
+		return err
+	}
+
+	return output.Close()
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect filename",
+	Short: "Prints the header, prefix codes and statistics of a compressed file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  inspect,
+}
+
+var inspectJSON bool
+
+func init() {
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "print a JSON document instead of text")
+	addLimitFlags(inspectCmd)
+	rootCmd.AddCommand(inspectCmd)
+}
+
+// inspectReport is what inspect prints, laid out for the JSON output.
+type inspectReport struct {
+	File     string `json:"file"`
+	Format   string `json:"format"`
+	Version  int    `json:"version,omitempty"`
+	Method   string `json:"method,omitempty"`
+	Coder    string `json:"coder,omitempty"`
+	Alphabet string `json:"alphabet,omitempty"`
+	Indexed  bool   `json:"indexed"`
+
+	Name    string `json:"name,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	ModTime string `json:"mtime,omitempty"`
+
+	Size           int64 `json:"size"`
+	CompressedSize int64 `json:"compressed_size"`
+	PayloadSize    int64 `json:"payload_size,omitempty"`
+
+	// Ratio is the compressed size over the original size, and BitsPerByte
+	// the compressed bits spent on every original byte.
+	Ratio       float64 `json:"ratio"`
+	BitsPerByte float64 `json:"bits_per_byte"`
+
+	Blocks []blockReport `json:"blocks,omitempty"`
+}
+
+type blockReport struct {
+	Offset   int64  `json:"offset"`
+	Length   int    `json:"length"`
+	BodySize int    `json:"body_size"`
+	Checksum uint32 `json:"checksum"`
+	Stored   bool   `json:"stored,omitempty"`
+
+	// SymbolCount and BitsPerSymbol, the code length averaged over the
+	// symbols of the block, are only known for blocks with one prefix code.
+	SymbolCount   int            `json:"symbol_count,omitempty"`
+	BitsPerSymbol float64        `json:"bits_per_symbol,omitempty"`
+	Symbols       []symbolReport `json:"symbols,omitempty"`
+}
+
+type symbolReport struct {
+	Symbol     rune   `json:"symbol"`
+	Bytes      string `json:"bytes"`
+	Frequency  int    `json:"frequency"`
+	CodeLength int    `json:"code_length"`
+	Code       string `json:"code"`
+}
+
+func inspect(cmd *cobra.Command, args []string) error {
+	filename := args[0]
+
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	stat, err := inputFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	info, err := huffman.Inspect(inputFile, stat.Size(), readerOptions())
+	if err != nil {
+		return err
+	}
+
+	report := newInspectReport(filename, info)
+
+	if inspectJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	return printInspectReport(cmd.OutOrStdout(), report)
+}
+
+func newInspectReport(filename string, info *huffman.FileInfo) inspectReport {
+
+	report := inspectReport{
+		File:           filename,
+		Format:         info.Format.String(),
+		Indexed:        info.Indexed,
+		Name:           info.Name,
+		Size:           info.Size,
+		CompressedSize: info.CompressedSize,
+	}
+	if info.Format == huffman.FormatNative {
+		report.Version = info.Version
+		report.Method = info.Method.String()
+		report.Coder = info.Coder.String()
+		report.Alphabet = info.Alphabet.String()
+	}
+	if info.Mode != 0 {
+		report.Mode = info.Mode.String()
+	}
+	if !info.ModTime.IsZero() {
+		report.ModTime = info.ModTime.Format(time.RFC3339Nano)
+	}
+	if info.Size > 0 {
+		report.Ratio = float64(info.CompressedSize) / float64(info.Size)
+		report.BitsPerByte = 8 * report.Ratio
+	}
+
+	for _, block := range info.Blocks {
+		blockReport := blockReport{
+			Offset:      block.Offset,
+			Length:      block.Length,
+			BodySize:    block.BodySize,
+			Checksum:    block.Checksum,
+			Stored:      block.Stored,
+			SymbolCount: len(block.Symbols),
+		}
+		report.PayloadSize += int64(block.BodySize)
+
+		bits, count := 0, 0
+		for _, symbol := range block.Symbols {
+			blockReport.Symbols = append(blockReport.Symbols, symbolReport(symbol))
+			bits += symbol.Frequency * symbol.CodeLength
+			count += symbol.Frequency
+		}
+		if count > 0 {
+			blockReport.BitsPerSymbol = float64(bits) / float64(count)
+		}
+
+		report.Blocks = append(report.Blocks, blockReport)
+	}
+
+	return report
+}
+
+func printInspectReport(output io.Writer, report inspectReport) error {
+
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "file:\t%s\n", report.File)
+	if report.Version != 0 {
+		fmt.Fprintf(w, "format:\t%s, version %d\n", report.Format, report.Version)
+		fmt.Fprintf(w, "method:\t%s, %s coder, %s alphabet\n", report.Method, report.Coder, report.Alphabet)
+		fmt.Fprintf(w, "index:\t%v\n", report.Indexed)
+	} else {
+		fmt.Fprintf(w, "format:\t%s\n", report.Format)
+	}
+	if report.Name != "" {
+		fmt.Fprintf(w, "name:\t%s\n", report.Name)
+	}
+	if report.Mode != "" {
+		fmt.Fprintf(w, "mode:\t%s\n", report.Mode)
+	}
+	if report.ModTime != "" {
+		fmt.Fprintf(w, "mtime:\t%s\n", report.ModTime)
+	}
+	fmt.Fprintf(w, "original size:\t%d bytes\n", report.Size)
+	if report.Version != 0 {
+		fmt.Fprintf(w, "compressed size:\t%d bytes, %d of them payload\n", report.CompressedSize, report.PayloadSize)
+	} else {
+		fmt.Fprintf(w, "compressed size:\t%d bytes\n", report.CompressedSize)
+	}
+	fmt.Fprintf(w, "ratio:\t%.1f%%, %.3f bits per byte\n", 100*report.Ratio, report.BitsPerByte)
+	if report.Version != 0 {
+		fmt.Fprintf(w, "blocks:\t%d\n", len(report.Blocks))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for i, block := range report.Blocks {
+		fmt.Fprintf(output, "\nblock %d at offset %d: %d bytes, body %d bytes, crc32 %08x", i, block.Offset, block.Length, block.BodySize, block.Checksum)
+		if block.Stored {
+			fmt.Fprint(output, ", stored")
+		}
+		if block.SymbolCount == 0 {
+			fmt.Fprintln(output)
+			continue
+		}
+		fmt.Fprintf(output, ", %d symbols, %.3f bits per symbol\n", block.SymbolCount, block.BitsPerSymbol)
+
+		w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "  symbol\tbytes\tfrequency\tlength\tcode\n")
+		for _, symbol := range block.Symbols {
+			fmt.Fprintf(w, "  %d\t%q\t%d\t%d\t%s\n", symbol.Symbol, symbol.Bytes, symbol.Frequency, symbol.CodeLength, symbol.Code)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
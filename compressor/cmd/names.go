@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffixes of compressed files, as in gzip's file.txt → file.txt.gz.
+const (
+	nativeSuffix = ".huf"
+	gzipSuffix   = ".gz"
+)
+
+// compressedName returns the default output name for compressing filename.
+func compressedName(filename string, format huffman.Format) (string, error) {
+	suffix := nativeSuffix
+	if format == huffman.FormatGzip {
+		suffix = gzipSuffix
+	}
+	if strings.HasSuffix(filename, suffix) {
+		return "", fmt.Errorf("%s already has the %s suffix, use --output to compress it again", filename, suffix)
+	}
+	return filename + suffix, nil
+}
+
+// decompressedName returns the default output name for decompressing
+// filename: filename without its suffix, or else the name recorded in its
+// header, in the same directory.
+func decompressedName(filename string) (string, error) {
+
+	for _, suffix := range []string{nativeSuffix, gzipSuffix} {
+		if name, found := strings.CutSuffix(filename, suffix); found && filepath.Base(filename) != suffix {
+			return name, nil
+		}
+	}
+
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer inputFile.Close()
+
+	reader, err := huffman.NewReader(inputFile)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the base name is used, so a crafted header cannot point
+	// elsewhere.
+	name := filepath.Base(filepath.FromSlash(reader.Name))
+	if reader.Name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", fmt.Errorf("%s has an unknown suffix and records no name, use --output to name the output", filename)
+	}
+
+	output := filepath.Join(filepath.Dir(filename), name)
+	if output == filepath.Clean(filename) {
+		return "", fmt.Errorf("%s would be decompressed onto itself, use --output to name the output", filename)
+	}
+
+	return output, nil
+}
+
+// checkOutput refuses to replace an existing output file unless --force was
+// given, and refuses to replace the input file even then, since creating the
+// output would truncate the input before it is read.
+func checkOutput(input string, output string) error {
+
+	outputInfo, err := os.Stat(output)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if input != stdioName {
+		if inputInfo, err := os.Stat(input); err == nil && os.SameFile(inputInfo, outputInfo) {
+			return fmt.Errorf("%s is the input file, use --output to name another output", output)
+		}
+	}
+
+	if !forceOverwrite {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+	}
+
+	return nil
+}
+
+// removeInput deletes the input of a successful run unless --keep was given.
+func removeInput(filename string) error {
+	if keepInput {
+		return nil
+	}
+	return os.Remove(filename)
+}
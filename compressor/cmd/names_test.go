@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"compressor/huffman"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// run executes the command line args with stdin as standard input and
+// returns what it wrote to standard output. Flags live in package variables,
+// so every flag is first put back to its default.
+func run(t *testing.T, stdin []byte, args ...string) ([]byte, error) {
+	t.Helper()
+
+	var reset func(cmd *cobra.Command)
+	reset = func(cmd *cobra.Command) {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		})
+		for _, sub := range cmd.Commands() {
+			reset(sub)
+		}
+	}
+	reset(rootCmd)
+
+	var stdout bytes.Buffer
+	rootCmd.SetArgs(args)
+	rootCmd.SetIn(bytes.NewReader(stdin))
+	rootCmd.SetOut(&stdout)
+	rootCmd.SetErr(io.Discard)
+	err := rootCmd.Execute()
+
+	return stdout.Bytes(), err
+}
+
+// writeCompressed writes data compressed with the given header to filename.
+func writeCompressed(t *testing.T, filename string, data []byte, header huffman.Header) {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer := huffman.NewWriter(&compressed)
+	writer.Header = header
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, compressed.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressedName(t *testing.T) {
+	tests := []struct {
+		filename string
+		format   huffman.Format
+		expected string
+	}{
+		{"file.txt", huffman.FormatNative, "file.txt.huf"},
+		{"file.txt", huffman.FormatGzip, "file.txt.gz"},
+		{"dir/file.huf", huffman.FormatGzip, "dir/file.huf.gz"},
+		{"file.gz", huffman.FormatNative, "file.gz.huf"},
+		{"file.huf", huffman.FormatNative, ""},
+		{"file.gz", huffman.FormatGzip, ""},
+	}
+
+	for _, test := range tests {
+		name, err := compressedName(test.filename, test.format)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("compressedName(%q, %v) = %q, expected an error", test.filename, test.format, name)
+			}
+			continue
+		}
+		if err != nil || name != test.expected {
+			t.Errorf("compressedName(%q, %v) = %q, %v, expected %q", test.filename, test.format, name, err, test.expected)
+		}
+	}
+}
+
+func TestDecompressedName(t *testing.T) {
+	dir := t.TempDir()
+
+	// Files without a known suffix are named after their header.
+	writeCompressed(t, filepath.Join(dir, "named"), nil, huffman.Header{Name: "original.txt"})
+	writeCompressed(t, filepath.Join(dir, "escaping"), nil, huffman.Header{Name: "../../etc/passwd"})
+	writeCompressed(t, filepath.Join(dir, "dots"), nil, huffman.Header{Name: ".."})
+	writeCompressed(t, filepath.Join(dir, "nameless"), nil, huffman.Header{})
+	writeCompressed(t, filepath.Join(dir, "itself"), nil, huffman.Header{Name: "itself"})
+	writeCompressed(t, filepath.Join(dir, ".huf"), nil, huffman.Header{Name: "hidden"})
+
+	tests := []struct {
+		filename string
+		expected string
+	}{
+		{"dir/file.txt.huf", "dir/file.txt"},
+		{"file.txt.gz", "file.txt"},
+		{filepath.Join(dir, "named"), filepath.Join(dir, "original.txt")},
+		{filepath.Join(dir, "escaping"), filepath.Join(dir, "passwd")},
+		{filepath.Join(dir, ".huf"), filepath.Join(dir, "hidden")},
+		{filepath.Join(dir, "dots"), ""},
+		{filepath.Join(dir, "nameless"), ""},
+		{filepath.Join(dir, "itself"), ""},
+		{filepath.Join(dir, "missing"), ""},
+	}
+
+	for _, test := range tests {
+		name, err := decompressedName(test.filename)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("decompressedName(%q) = %q, expected an error", test.filename, name)
+			}
+			continue
+		}
+		if err != nil || name != test.expected {
+			t.Errorf("decompressedName(%q) = %q, %v, expected %q", test.filename, name, err, test.expected)
+		}
+	}
+}
+
+// TestOverwrite checks that compress, decompress and extract refuse to
+// replace an existing file unless --force is given, and that --keep decides
+// whether the input survives.
+func TestOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "file.txt")
+	data := []byte(strings.Repeat("overwrite me if you are forced to\n", 100))
+	existing := []byte("already here")
+
+	writeFiles := func() {
+		t.Helper()
+		if err := os.WriteFile(input, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{input + ".huf", filepath.Join(dir, "extracted")} {
+			if err := os.WriteFile(name, existing, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	contents := func(name string) []byte {
+		t.Helper()
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	writeFiles()
+	if _, err := run(t, nil, "compress", input); err == nil || !bytes.Equal(contents(input+".huf"), existing) {
+		t.Errorf("compress replaced an existing file without --force: %v", err)
+	}
+	if _, err := run(t, nil, "compress", "-k", "-f", input); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(input); err != nil {
+		t.Errorf("compress --keep removed its input: %v", err)
+	}
+
+	if _, err := run(t, nil, "decompress", "-k", input+".huf"); err == nil || !bytes.Equal(contents(input), data) {
+		t.Errorf("decompress replaced an existing file without --force: %v", err)
+	}
+	os.WriteFile(input, existing, 0o644)
+	if _, err := run(t, nil, "decompress", "-f", input+".huf"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents(input), data) {
+		t.Errorf("decompress --force did not restore the original")
+	}
+	if _, err := os.Stat(input + ".huf"); err == nil {
+		t.Errorf("decompress without --keep left its input behind")
+	}
+
+	writeFiles()
+	if _, err := run(t, nil, "compress", "-f", "-k", "--index", input); err != nil {
+		t.Fatal(err)
+	}
+	extracted := filepath.Join(dir, "extracted")
+	if _, err := run(t, nil, "extract", "-o", extracted, input+".huf"); err == nil || !bytes.Equal(contents(extracted), existing) {
+		t.Errorf("extract replaced an existing file without --force: %v", err)
+	}
+	if _, err := run(t, nil, "extract", "-f", "-o", extracted, "--offset", "10", "--length", "20", input+".huf"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents(extracted), data[10:30]) {
+		t.Errorf("extract --force wrote %q, expected %q", contents(extracted), data[10:30])
+	}
+}
+
+// TestOutputIsInput checks that no command replaces its own input, not even
+// with --force, since creating the output would truncate the input first.
+func TestOutputIsInput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "file.txt")
+	compressed := filepath.Join(dir, "file.txt.huf")
+	link := filepath.Join(dir, "link")
+	data := []byte(strings.Repeat("do not eat your own input\n", 100))
+
+	if err := os.WriteFile(input, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, nil, "compress", "-k", "--index", input); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(input, link); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		filename string
+		data     []byte
+	}{
+		{[]string{"compress", "-f", "-o", input, input}, input, data},
+		{[]string{"compress", "-f", "-o", link, input}, input, data},
+		{[]string{"compress", "-f", "-c", "-o", input, input}, input, data},
+		{[]string{"decompress", "-f", "-o", compressed, compressed}, compressed, want},
+		{[]string{"decompress", "-f", "-c", "-o", compressed, compressed}, compressed, want},
+		{[]string{"extract", "-f", "-o", compressed, compressed}, compressed, want},
+		{[]string{"recover", "-f", "-o", compressed, compressed}, compressed, want},
+	}
+
+	for _, test := range tests {
+		if _, err := run(t, nil, test.args...); err == nil {
+			t.Errorf("%v succeeded, expected an error", test.args)
+		}
+		got, err := os.ReadFile(test.filename)
+		if err != nil {
+			t.Fatalf("%v: %v", test.args, err)
+		}
+		if !bytes.Equal(got, test.data) {
+			t.Errorf("%v changed %s", test.args, test.filename)
+		}
+	}
+}
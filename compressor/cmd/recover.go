@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover filename",
+	Short: "Salvages every intact block of a damaged compressed file and reports the byte ranges lost",
+	Args:  cobra.ExactArgs(1),
+	RunE:  recoverFile,
+}
+
+var (
+	recoverOutputFilename string
+	skipLost              bool
+)
+
+func init() {
+	recoverCmd.Flags().StringVarP(&recoverOutputFilename, "output", "o", "", "specify the output file name (default the input name without its suffix)")
+	recoverCmd.Flags().BoolVarP(&writeToStdout, "stdout", "c", false, "write to standard output")
+	recoverCmd.Flags().BoolVar(&skipLost, "skip-lost", false, "leave lost ranges out instead of filling them with zero bytes")
+	recoverCmd.Flags().BoolVarP(&forceOverwrite, "force", "f", false, "overwrite an existing output file")
+	recoverCmd.MarkFlagsMutuallyExclusive("stdout", "output")
+	addLimitFlags(recoverCmd)
+	rootCmd.AddCommand(recoverCmd)
+}
+
+func recoverFile(cmd *cobra.Command, args []string) error {
+	filename := args[0]
+
+	// Recovery scans back and forth, so it needs a file, not a stream.
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	output := recoverOutputFilename
+	if output == "" && !writeToStdout {
+		if output, err = decompressedName(filename); err != nil {
+			return err
+		}
+	}
+
+	outputFile, err := createOutput(cmd, filename, output)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	rec, err := huffman.Recover(outputFile, inputFile, info.Size(), !skipLost, readerOptions())
+	if err != nil {
+		return err
+	}
+	if err := outputFile.Close(); err != nil {
+		return err
+	}
+
+	printRecovery(cmd.ErrOrStderr(), filename, rec)
+
+	if len(rec.Lost) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%s: %d byte ranges were lost", filename, len(rec.Lost))
+	}
+
+	return nil
+}
+
+func printRecovery(w io.Writer, filename string, rec *huffman.Recovery) {
+
+	size := fmt.Sprintf("%d", rec.Size)
+	if !rec.SizeKnown {
+		size = "at least " + size
+	}
+	fmt.Fprintf(w, "%s: recovered %d of %s bytes\n", filename, rec.Recovered, size)
+
+	for _, r := range rec.Lost {
+		fmt.Fprintf(w, "%s: lost bytes %d-%d (%d bytes)\n", filename, r.Start, r.End, r.End-r.Start)
+	}
+	if !rec.SizeKnown {
+		fmt.Fprintf(w, "%s: the trailer was lost, so data past byte %d may be missing\n", filename, rec.Size)
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// stdioName stands for standard input as an input file name.
+const stdioName = "-"
+
+// writeToStdout is set by -c/--stdout on compress and decompress.
+var writeToStdout bool
+
+// openInput opens filename, or standard input for stdioName, and returns the
+// Header describing it. Standard input has no Header.
+func openInput(cmd *cobra.Command, filename string) (io.ReadCloser, huffman.Header, error) {
+
+	if filename == stdioName {
+		return io.NopCloser(cmd.InOrStdin()), huffman.Header{}, nil
+	}
+
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return nil, huffman.Header{}, err
+	}
+
+	info, err := inputFile.Stat()
+	if err != nil {
+		inputFile.Close()
+		return nil, huffman.Header{}, err
+	}
+
+	return inputFile, huffman.Header{Name: filepath.Base(filename), Mode: info.Mode().Perm(), ModTime: info.ModTime()}, nil
+}
+
+// createOutput creates filename as the output for input, or returns standard
+// output when filename is empty. Closing standard output is a no-op, so it can
+// be closed like a file.
+func createOutput(cmd *cobra.Command, input string, filename string) (io.WriteCloser, error) {
+
+	if filename == "" {
+		return nopWriteCloser{cmd.OutOrStdout()}, nil
+	}
+
+	if err := checkOutput(input, filename); err != nil {
+		return nil, err
+	}
+
+	return os.Create(filename)
+}
+
+// discardOutput closes output and removes filename, the file it was created
+// as, after err left it unfinished. Standard output, with no filename, is left
+// alone. It returns err.
+func discardOutput(output io.Closer, filename string, err error) error {
+	output.Close()
+	if filename != "" {
+		os.Remove(filename)
+	}
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// errTerminal is returned instead of writing compressed data to a terminal.
+var errTerminal = errors.New("compressed data not written to a terminal, use --force to write it anyway")
+
+// isTerminal reports whether w is a terminal. Being a character device is
+// not enough, since /dev/null is one too, so the device must also answer the
+// ioctl that reads terminal attributes.
+func isTerminal(w io.Writer) bool {
+	if nop, ok := w.(nopWriteCloser); ok {
+		w = nop.Writer
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return isTerminalFd(file.Fd())
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"compressor/huffman"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStream checks that -c and - read and write the standard streams and
+// leave the input file in place.
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "file.txt")
+	data := []byte(strings.Repeat("to the standard streams and back\n", 100))
+	if err := os.WriteFile(input, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []huffman.Format{huffman.FormatNative, huffman.FormatGzip} {
+		compressed, err := run(t, nil, "compress", "-c", "--format", format.String(), input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(input); err != nil {
+			t.Fatalf("compress -c removed its input: %v", err)
+		}
+
+		decompressed, err := run(t, compressed, "decompress", "-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%v: decompress - gave %d bytes, expected %d", format, len(decompressed), len(data))
+		}
+
+		// Data from standard input goes to --output, which is refused if
+		// it exists unless --force is given.
+		output := filepath.Join(dir, "stdin"+format.String())
+		if _, err := run(t, data, "compress", "--format", format.String(), "-o", output, "-"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, data, "compress", "--format", format.String(), "-o", output, "-"); err == nil {
+			t.Errorf("%v: compress - replaced %s without --force", format, output)
+		}
+		if _, err := run(t, data, "compress", "-f", "--format", format.String(), "-o", output, "-"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := run(t, nil, "decompress", "-c", output); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(output); err != nil {
+			t.Errorf("%v: decompress -c removed its input: %v", format, err)
+		}
+	}
+}
+
+// TestFailedOutputRemoved checks that a compression or decompression that
+// fails removes the --output file it created, so the next run is not refused.
+func TestFailedOutputRemoved(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(input, []byte("more than sixteen different bytes: 0123456789abcdef"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "output")
+	compressed, err := run(t, nil, "compress", "-c", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stdin []byte
+		args  []string
+	}{
+		{nil, []string{"compress", "-k", "-o", output, dir}},
+		{nil, []string{"compress", "-k", "--max-code-length", "4", "-o", output, input}},
+		{nil, []string{"compress", "-c", "--max-code-length", "4", "-o", output, input}},
+		{compressed[:len(compressed)-10], []string{"decompress", "-o", output, "-"}},
+	}
+
+	for _, test := range tests {
+		if _, err := run(t, test.stdin, test.args...); err == nil {
+			t.Errorf("%v succeeded, expected an error", test.args)
+		}
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Errorf("%v left %s behind: %v", test.args, output, err)
+			os.Remove(output)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+
+	regular, err := os.Create(filepath.Join(t.TempDir(), "regular"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer regular.Close()
+
+	for _, w := range []io.Writer{null, nopWriteCloser{null}, regular, &bytes.Buffer{}} {
+		if isTerminal(w) {
+			t.Errorf("isTerminal(%T) = true", w)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cmd
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminalFd reports whether fd accepts TIOCGETA, which only terminals do.
+func isTerminalFd(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGETA, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package cmd
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminalFd reports whether fd accepts TCGETS, which only terminals do.
+func isTerminalFd(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package cmd
+
+// isTerminalFd cannot tell a terminal from another character device here,
+// so it lets the data through.
+func isTerminalFd(fd uintptr) bool {
+	return false
+}
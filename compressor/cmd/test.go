@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"compressor/huffman"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test filename...",
+	Short: "Checks that compressed files decompress intact, without writing any output",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  test,
+}
+
+func init() {
+	addLimitFlags(testCmd)
+	rootCmd.AddCommand(testCmd)
+}
+
+func test(cmd *cobra.Command, args []string) error {
+
+	damaged := 0
+	for _, filename := range args {
+		if err := testFile(cmd, filename); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", filename, err)
+			damaged++
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: OK\n", filename)
+	}
+
+	if damaged > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d of %d files are damaged", damaged, len(args))
+	}
+
+	return nil
+}
+
+// testFile decompresses filename, or standard input, and discards the data.
+// Errors that do not name a block say how far decompression got.
+func testFile(cmd *cobra.Command, filename string) error {
+
+	input, _, err := openInput(cmd, filename)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	reader, err := huffman.NewReaderOptions(input, readerOptions())
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(io.Discard, reader)
+	var blockErr *huffman.BlockError
+	if err != nil && !errors.As(err, &blockErr) {
+		return fmt.Errorf("after %d bytes of original data: %w", n, err)
+	}
+
+	return err
+}
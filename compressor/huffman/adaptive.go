@@ -0,0 +1,231 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"fmt"
+)
+
+// adaptiveAlphabetSize is the number of symbols an adaptive tree can hold.
+const adaptiveAlphabetSize = 256
+
+// adaptiveNode is a node of an FGK tree. Child and parent fields hold node
+// ids, with -1 for none.
+type adaptiveNode struct {
+	weight int
+	parent int
+	left   int
+	right  int
+
+	// symbol is the byte held by a leaf, or -1 for the NYT leaf and for
+	// internal nodes.
+	symbol int
+
+	// number is the node's position in the sibling ordering: weights never
+	// decrease with increasing number, and siblings are numbered
+	// consecutively.
+	number int
+}
+
+// adaptiveTree is a Huffman tree maintained with the FGK algorithm. Encoder
+// and decoder start from the same empty tree and apply the same update after
+// every symbol, so they stay in step without a stored table. Symbols not yet
+// seen are sent as the code of the NYT ("not yet transmitted") leaf followed
+// by the raw byte.
+type adaptiveTree struct {
+	nodes    []adaptiveNode
+	byNumber []int
+	leaves   [adaptiveAlphabetSize]int
+	nyt      int
+	root     int
+
+	// path is scratch space for the encoder's leaf-to-root walk.
+	path []uint8
+}
+
+func newAdaptiveTree() *adaptiveTree {
+
+	maxNumber := 2 * adaptiveAlphabetSize
+
+	tree := &adaptiveTree{
+		nodes:    make([]adaptiveNode, 0, maxNumber+1),
+		byNumber: make([]int, maxNumber+1),
+	}
+	for i := range tree.leaves {
+		tree.leaves[i] = -1
+	}
+
+	tree.nodes = append(tree.nodes, adaptiveNode{parent: -1, left: -1, right: -1, symbol: -1, number: maxNumber})
+	tree.byNumber[maxNumber] = 0
+
+	return tree
+}
+
+// addSymbol splits the NYT leaf into a new NYT leaf and a leaf for symbol,
+// and returns the id of the new symbol leaf.
+func (tree *adaptiveTree) addSymbol(symbol byte) int {
+
+	parent := tree.nyt
+	number := tree.nodes[parent].number
+
+	nyt := len(tree.nodes)
+	leaf := nyt + 1
+	tree.nodes = append(tree.nodes,
+		adaptiveNode{parent: parent, left: -1, right: -1, symbol: -1, number: number - 2},
+		adaptiveNode{parent: parent, left: -1, right: -1, symbol: int(symbol), number: number - 1},
+	)
+	tree.byNumber[number-2] = nyt
+	tree.byNumber[number-1] = leaf
+
+	tree.nodes[parent].left = nyt
+	tree.nodes[parent].right = leaf
+	tree.nyt = nyt
+	tree.leaves[symbol] = leaf
+
+	return leaf
+}
+
+// update increments the weight of node and its ancestors, first swapping each
+// with the highest-numbered node of equal weight so that the sibling property
+// keeps holding.
+func (tree *adaptiveTree) update(node int) {
+
+	for node != -1 {
+		weight := tree.nodes[node].weight
+
+		leaderNumber := tree.nodes[node].number
+		for leaderNumber+1 < len(tree.byNumber) && tree.nodes[tree.byNumber[leaderNumber+1]].weight == weight {
+			leaderNumber++
+		}
+
+		leader := tree.byNumber[leaderNumber]
+		if leader != node && leader != tree.nodes[node].parent {
+			tree.swap(node, leader)
+		}
+
+		tree.nodes[node].weight++
+		node = tree.nodes[node].parent
+	}
+}
+
+// swap exchanges the positions of two nodes, and their subtrees, in both the
+// tree and the numbering. Neither node may be an ancestor of the other.
+func (tree *adaptiveTree) swap(a, b int) {
+
+	nodeA, nodeB := &tree.nodes[a], &tree.nodes[b]
+	parentA, parentB := nodeA.parent, nodeB.parent
+
+	tree.replaceChild(parentA, a, -2)
+	tree.replaceChild(parentB, b, a)
+	tree.replaceChild(parentA, -2, b)
+
+	nodeA.parent, nodeB.parent = parentB, parentA
+	nodeA.number, nodeB.number = nodeB.number, nodeA.number
+	tree.byNumber[nodeA.number] = a
+	tree.byNumber[nodeB.number] = b
+}
+
+func (tree *adaptiveTree) replaceChild(parent, old, new int) {
+	if tree.nodes[parent].left == old {
+		tree.nodes[parent].left = new
+	} else {
+		tree.nodes[parent].right = new
+	}
+}
+
+// encode appends the code for symbol to bw and updates the tree.
+func (tree *adaptiveTree) encode(bw *bitio.Writer, symbol byte) {
+
+	node := tree.leaves[symbol]
+	if node == -1 {
+		tree.writePath(bw, tree.nyt)
+		bw.WriteBits(uint64(symbol), 8)
+		node = tree.addSymbol(symbol)
+	} else {
+		tree.writePath(bw, node)
+	}
+
+	tree.update(node)
+}
+
+// writePath writes the branches from the root down to node.
+func (tree *adaptiveTree) writePath(bw *bitio.Writer, node int) {
+
+	tree.path = tree.path[:0]
+	for node != tree.root {
+		parent := tree.nodes[node].parent
+		if tree.nodes[parent].right == node {
+			tree.path = append(tree.path, 1)
+		} else {
+			tree.path = append(tree.path, 0)
+		}
+		node = parent
+	}
+
+	for i := len(tree.path) - 1; i >= 0; i-- {
+		bw.WriteBits(uint64(tree.path[i]), 1)
+	}
+}
+
+// decode reads one symbol from br and updates the tree.
+func (tree *adaptiveTree) decode(br *bitio.Reader) (byte, error) {
+
+	node := tree.root
+	for tree.nodes[node].left != -1 {
+		br.Fill()
+		if br.Peek(1) == 1 {
+			node = tree.nodes[node].right
+		} else {
+			node = tree.nodes[node].left
+		}
+		if err := br.Consume(1); err != nil {
+			return 0, err
+		}
+	}
+
+	if node == tree.nyt {
+		br.Fill()
+		symbol := byte(br.Peek(8))
+		if err := br.Consume(8); err != nil {
+			return 0, err
+		}
+		if tree.leaves[symbol] != -1 {
+			return 0, fmt.Errorf("%w: symbol %d sent twice as new", ErrCorrupt, symbol)
+		}
+		node = tree.addSymbol(symbol)
+	}
+
+	tree.update(node)
+
+	return byte(tree.nodes[node].symbol), nil
+}
+
+// encodeAdaptiveBlock codes data in a single pass with a fresh adaptive tree.
+func encodeAdaptiveBlock(body *bytes.Buffer, data []byte) {
+
+	tree := newAdaptiveTree()
+	bw := bitio.NewWriter(body)
+
+	for _, symbol := range data {
+		tree.encode(bw, symbol)
+	}
+
+	bw.Flush()
+}
+
+// adaptiveBlock decodes a block coded by encodeAdaptiveBlock.
+type adaptiveBlock struct {
+	tree *adaptiveTree
+	bits *bitio.Reader
+}
+
+func (b *adaptiveBlock) decode(p []byte) (int, error) {
+	for i := range p {
+		symbol, err := b.tree.decode(b.bits)
+		if err != nil {
+			return i, err
+		}
+		p[i] = symbol
+	}
+	return len(p), nil
+}
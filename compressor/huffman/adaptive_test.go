@@ -0,0 +1,55 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// TestAdaptiveRoundTrip round-trips inputs that exercise the FGK updates:
+// every byte value, long runs, and a distribution that drifts over time.
+func TestAdaptiveRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	allBytes := make([]byte, 256*4)
+	for i := range allBytes {
+		allBytes[i] = byte(i)
+	}
+
+	drifting := make([]byte, 20000)
+	for i := range drifting {
+		drifting[i] = byte('a' + random.Intn(1+i/1000))
+	}
+
+	inputs := map[string][]byte{
+		"empty":    {},
+		"single":   []byte("a"),
+		"run":      bytes.Repeat([]byte("z"), 5000),
+		"text":     []byte("adaptive huffman coding updates the tree after every symbol\n"),
+		"allBytes": allBytes,
+		"drifting": drifting,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			compressed := compressBytes(t, input, WriterOptions{Method: MethodAdaptive, BlockSize: 4096})
+
+			reader, err := NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.header.method != MethodAdaptive {
+				t.Errorf("header records method %v, expected %v", reader.header.method, MethodAdaptive)
+			}
+
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("round trip mismatch: got %d bytes, expected %d", len(output), len(input))
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// Alphabet selects what a MethodHuffman block counts as one symbol. It is
+// recorded in the file header.
+type Alphabet uint8
+
+const (
+	// AlphabetByte codes every byte on its own.
+	AlphabetByte Alphabet = iota
+
+	// AlphabetRune codes every UTF-8 encoded code point as one symbol.
+	// Bytes that are not valid UTF-8 are coded as symbols of their own.
+	AlphabetRune
+
+	// AlphabetWord codes every whitespace-separated word that recurs in a
+	// block as one symbol, listing the words in front of the block. Rare
+	// words, and the whitespace between words, are escaped to single bytes.
+	AlphabetWord
+
+	// AlphabetExtended codes frequent byte pairs and triples of a block as
+	// extended symbols of their own, listed in front of the block, and
+	// every other byte on its own.
+	AlphabetExtended
+)
+
+var alphabetNames = map[Alphabet]string{
+	AlphabetByte:     "byte",
+	AlphabetRune:     "rune",
+	AlphabetWord:     "word",
+	AlphabetExtended: "extended",
+}
+
+func (a Alphabet) String() string {
+	if name, ok := alphabetNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Alphabet(%d)", uint8(a))
+}
+
+// ParseAlphabet returns the Alphabet with the given name.
+func ParseAlphabet(name string) (Alphabet, error) {
+	for alphabet, alphabetName := range alphabetNames {
+		if alphabetName == name {
+			return alphabet, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown alphabet %q", name)
+}
+
+func (a Alphabet) valid() bool {
+	_, ok := alphabetNames[a]
+	return ok
+}
+
+// listsSymbols reports whether blocks of the alphabet list byte strings,
+// coded as the symbols from firstWordSymbol on.
+func (a Alphabet) listsSymbols() bool {
+	return a == AlphabetWord || a == AlphabetExtended
+}
+
+const (
+	// invalidByteSymbol is the first of the 256 AlphabetRune symbols that
+	// stand for bytes outside valid UTF-8, just past the last code point.
+	invalidByteSymbol = utf8.MaxRune + 1
+
+	// firstWordSymbol is the symbol of the first word or extended symbol
+	// listed by AlphabetWord and AlphabetExtended. The symbols below it are
+	// single bytes.
+	firstWordSymbol = 256
+
+	// minWordCount is how often a word must occur in a block to be listed.
+	minWordCount = 4
+)
+
+func isSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
+
+// runeSymbols splits data into AlphabetRune symbols.
+func runeSymbols(data []byte) []rune {
+	symbols := make([]rune, 0, len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			r = invalidByteSymbol + rune(data[0])
+		}
+		symbols = append(symbols, r)
+		data = data[size:]
+	}
+	return symbols
+}
+
+// splitWords calls f with every maximal run of non-whitespace bytes in data,
+// and with every whitespace byte on its own.
+func splitWords(data []byte, f func(token []byte)) {
+	for len(data) > 0 {
+		end := 1
+		if !isSpace(data[0]) {
+			for end < len(data) && !isSpace(data[end]) {
+				end++
+			}
+		}
+		f(data[:end])
+		data = data[end:]
+	}
+}
+
+// wordSymbols splits data into AlphabetWord symbols. The words that occur at
+// least minWordCount times are listed, most frequent first, up to the number
+// of symbols that maxSymbols leaves room for.
+func wordSymbols(data []byte, maxSymbols int) ([]rune, []string) {
+
+	counts := make(map[string]int)
+	splitWords(data, func(token []byte) {
+		if len(token) > 1 {
+			counts[string(token)]++
+		}
+	})
+
+	var words []string
+	for word, count := range counts {
+		if count >= minWordCount {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	words = words[:min(len(words), max(0, maxSymbols-firstWordSymbol))]
+
+	ids := make(map[string]rune, len(words))
+	for i, word := range words {
+		ids[word] = firstWordSymbol + rune(i)
+	}
+
+	symbols := make([]rune, 0, len(data)/2)
+	splitWords(data, func(token []byte) {
+		if id, ok := ids[string(token)]; ok {
+			symbols = append(symbols, id)
+			return
+		}
+		for _, b := range token {
+			symbols = append(symbols, rune(b))
+		}
+	})
+
+	return symbols, words
+}
+
+// encodeWideBlock codes data with a table built from its own statistics, like
+// encodeStaticBlock, but over the symbols of a wider alphabet. The body
+// starts with the listed words or extended symbols, if any, as a uvarint
+// count and uvarint-prefixed byte strings. The code lengths follow as a
+// uvarint symbol count and, in symbol order, the uvarint gap to the previous
+// symbol and a code length byte.
+func encodeWideBlock(body *bytes.Buffer, data []byte, alphabet Alphabet, maxCodeLength int) error {
+
+	var symbols []rune
+	var words []string
+	if alphabet.listsSymbols() {
+		if alphabet == AlphabetWord {
+			symbols, words = wordSymbols(data, 1<<maxCodeLength)
+		} else {
+			symbols, words = extendedSymbols(data, 1<<maxCodeLength)
+		}
+		writeUvarint(body, uint64(len(words)))
+		for _, word := range words {
+			writeUvarint(body, uint64(len(word)))
+			body.WriteString(word)
+		}
+	} else {
+		symbols = runeSymbols(data)
+	}
+
+	frequency := make(map[rune]int)
+	for _, symbol := range symbols {
+		frequency[symbol]++
+	}
+	if len(frequency) > 1<<maxCodeLength {
+		return fmt.Errorf("huffman: %d symbols cannot be coded in %d bits", len(frequency), maxCodeLength)
+	}
+
+	lengths := limitCodeLengths(frequency, maxCodeLength)
+
+	writeUvarint(body, uint64(len(lengths)))
+	previous := rune(-1)
+	for _, symbol := range sortedSymbols(lengths) {
+		writeUvarint(body, uint64(symbol-previous-1))
+		body.WriteByte(byte(lengths[symbol]))
+		previous = symbol
+	}
+
+	codes := make(map[rune]bitio.Code, len(lengths))
+	canonical, values := canonicalOrder(lengths)
+	for i, symbol := range canonical {
+		codes[symbol] = bitio.Code{Bits: uint64(values[i]), Length: uint(lengths[symbol])}
+	}
+
+	bw := bitio.NewWriter(body)
+	for _, symbol := range symbols {
+		bw.WriteCode(codes[symbol])
+	}
+	bw.Flush()
+
+	return nil
+}
+
+func writeUvarint(w *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+// wideBlock decodes a block coded by encodeWideBlock.
+type wideBlock struct {
+	alphabet Alphabet
+
+	// words holds the listed words or extended symbols.
+	words [][]byte
+	table *decodeTable
+	bits  *bitio.Reader
+
+	// pending holds the bytes of the last symbol that did not fit into p.
+	pending []byte
+	buffer  [utf8.UTFMax]byte
+}
+
+func newWideBlock(body []byte, alphabet Alphabet) (*wideBlock, error) {
+
+	reader := bytes.NewReader(body)
+
+	words, lengths, err := readWideTable(reader, alphabet)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := newDecodeTable(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wideBlock{
+		alphabet: alphabet,
+		words:    words,
+		table:    table,
+		bits:     bitio.NewReader(reader),
+	}, nil
+}
+
+// readWideTable reads the listed words or extended symbols, if any, and the
+// code lengths written by encodeWideBlock.
+func readWideTable(reader *bytes.Reader, alphabet Alphabet) ([][]byte, map[rune]int, error) {
+
+	var words [][]byte
+	numSymbols := rune(invalidByteSymbol + 256)
+	if alphabet.listsSymbols() {
+		numWords, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, nil, noEOF(err)
+		}
+		if numWords > uint64(reader.Len()) {
+			return nil, nil, fmt.Errorf("%w: %d words listed", ErrHeader, numWords)
+		}
+		words = make([][]byte, numWords)
+		for i := range words {
+			length, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, nil, noEOF(err)
+			}
+			if length == 0 {
+				return nil, nil, fmt.Errorf("%w: empty word listed", ErrHeader)
+			}
+			if length > uint64(reader.Len()) {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			words[i] = make([]byte, length)
+			reader.Read(words[i])
+		}
+		numSymbols = firstWordSymbol + rune(numWords)
+	}
+
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, nil, noEOF(err)
+	}
+	if count == 0 || count > uint64(reader.Len()) {
+		return nil, nil, fmt.Errorf("%w: %d symbols in prefix table", ErrHeader, count)
+	}
+
+	lengths := make(map[rune]int, count)
+	symbol := int64(-1)
+	for i := uint64(0); i < count; i++ {
+		gap, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, nil, noEOF(err)
+		}
+		length, err := reader.ReadByte()
+		if err != nil {
+			return nil, nil, noEOF(err)
+		}
+		if gap >= uint64(numSymbols) {
+			return nil, nil, fmt.Errorf("%w: symbol out of range in prefix table", ErrHeader)
+		}
+		symbol += int64(gap) + 1
+		if symbol >= int64(numSymbols) {
+			return nil, nil, fmt.Errorf("%w: symbol %d out of range in prefix table", ErrHeader, symbol)
+		}
+		if length > maxCodeLengthLimit {
+			return nil, nil, fmt.Errorf("%w: code length %d exceeds %d bits", ErrHeader, length, maxCodeLengthLimit)
+		}
+		lengths[rune(symbol)] = int(length)
+	}
+
+	return words, lengths, nil
+}
+
+func (b *wideBlock) decode(p []byte) (int, error) {
+
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+
+	for n < len(p) {
+		symbol, err := b.table.decodeOne(b.bits)
+		if err != nil {
+			return n, err
+		}
+
+		expanded := expandSymbol(b.buffer[:0], symbol, b.alphabet, b.words)
+		if len(expanded) == 0 {
+			return n, fmt.Errorf("%w: symbol %d stands for no bytes", ErrCorrupt, symbol)
+		}
+
+		copied := copy(p[n:], expanded)
+		b.pending = expanded[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+// expandSymbol appends the bytes that symbol stands for in the given
+// alphabet to buffer, looking listed symbols up in words.
+func expandSymbol(buffer []byte, symbol rune, alphabet Alphabet, words [][]byte) []byte {
+	switch {
+	case alphabet.listsSymbols() && symbol >= firstWordSymbol:
+		return words[symbol-firstWordSymbol]
+	case alphabet != AlphabetRune || symbol >= invalidByteSymbol:
+		return append(buffer, byte(symbol))
+	default:
+		return utf8.AppendRune(buffer, symbol)
+	}
+}
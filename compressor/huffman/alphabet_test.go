@@ -0,0 +1,167 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestAlphabetRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	noise := make([]byte, 20000)
+	random.Read(noise)
+
+	// Multi-byte code points, split across blocks by the small block size.
+	accents := []byte(strings.Repeat("Les Misérables — « Fantine », 第一卷 😀\n", 500))
+
+	inputs := map[string][]byte{
+		"single":  []byte("a"),
+		"space":   []byte(" "),
+		"run":     bytes.Repeat([]byte("z"), 5000),
+		"noise":   noise,
+		"accents": accents,
+		"invalid": append([]byte("valid \xff\xfe then \xe2\x82 cut"), accents[:1001]...),
+		"text":    benchmarkInput(),
+	}
+
+	for name, input := range inputs {
+		for _, alphabet := range []Alphabet{AlphabetByte, AlphabetRune, AlphabetWord} {
+			compressed := compressBytes(t, input, WriterOptions{Alphabet: alphabet, BlockSize: 1000})
+
+			reader, err := NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.header.alphabet != alphabet {
+				t.Errorf("header records alphabet %v, expected %v", reader.header.alphabet, alphabet)
+			}
+
+			// Read in small pieces so that words are split between calls.
+			output, err := io.ReadAll(iotestHalfReader{reader})
+			if err != nil {
+				t.Fatalf("%s, %v: %v", name, alphabet, err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("%s, %v: round trip mismatch: got %d bytes, expected %d", name, alphabet, len(output), len(input))
+			}
+		}
+	}
+}
+
+func TestRuneSymbols(t *testing.T) {
+	symbols := runeSymbols([]byte("é\xff😀"))
+	expected := []rune{'é', invalidByteSymbol + 0xff, '😀'}
+	if len(symbols) != len(expected) {
+		t.Fatalf("runeSymbols = %v, expected %v", symbols, expected)
+	}
+	for i := range expected {
+		if symbols[i] != expected[i] {
+			t.Errorf("runeSymbols = %v, expected %v", symbols, expected)
+		}
+	}
+}
+
+func TestWordSymbols(t *testing.T) {
+	input := []byte(strings.Repeat("the cat sat on the mat\n", 4) + "a rare word")
+
+	symbols, words := wordSymbols(input, 1<<DefaultMaxCodeLength)
+	if len(words) == 0 || words[0] != "the" {
+		t.Fatalf("words = %q, expected \"the\" first", words)
+	}
+	for _, word := range words {
+		if word == "rare" || word == "word" {
+			t.Errorf("word %q listed after occurring once", word)
+		}
+	}
+
+	var expanded []byte
+	for _, symbol := range symbols {
+		if symbol >= firstWordSymbol {
+			expanded = append(expanded, words[symbol-firstWordSymbol]...)
+		} else {
+			expanded = append(expanded, byte(symbol))
+		}
+	}
+	if !bytes.Equal(expanded, input) {
+		t.Errorf("symbols expand to %q, expected %q", expanded, input)
+	}
+
+	// With no room for words beyond the bytes, everything is escaped.
+	if _, words := wordSymbols(input, firstWordSymbol); len(words) != 0 {
+		t.Errorf("words = %q, expected none", words)
+	}
+}
+
+// TestWordAlphabetBeatsByte checks that listing recurring words pays for the
+// word list on text.
+func TestWordAlphabetBeatsByte(t *testing.T) {
+	input := benchmarkInput()
+
+	byteSize := len(compressBytes(t, input, WriterOptions{}))
+	wordSize := len(compressBytes(t, input, WriterOptions{Alphabet: AlphabetWord}))
+
+	if wordSize >= byteSize {
+		t.Errorf("word alphabet wrote %d bytes, byte alphabet %d", wordSize, byteSize)
+	}
+}
+
+func TestWriterRejectsAlphabetCombinations(t *testing.T) {
+	for _, options := range []WriterOptions{
+		{Alphabet: AlphabetRune, Method: MethodLZ},
+		{Alphabet: AlphabetWord, Coder: CoderRange},
+		{Alphabet: AlphabetWord, Format: FormatGzip},
+		{Alphabet: Alphabet(9)},
+	} {
+		if _, err := NewWriterOptions(io.Discard, options); err == nil {
+			t.Errorf("NewWriterOptions(%+v) succeeded", options)
+		}
+	}
+}
+
+// emptyWordFile returns a crafted 46-byte file whose only block lists one
+// empty word and gives it the empty code, so that every symbol decoded from
+// it takes no bits and stands for no bytes.
+func emptyWordFile(tb testing.TB) []byte {
+	var file bytes.Buffer
+	body := []byte{1, 0, 1, 0x80, 0x02, 0}
+	if err := writeFileHeader(&file, fileHeader{version: formatVersion, alphabet: AlphabetWord}); err != nil {
+		tb.Fatal(err)
+	}
+	if err := writeBlockHeader(&file, blockHeader{length: 100, size: uint32(len(body))}); err != nil {
+		tb.Fatal(err)
+	}
+	file.Write(body)
+	return file.Bytes()
+}
+
+// TestEmptyWords checks that a listed word of no bytes is rejected rather
+// than decoded forever, and that a symbol expanding to nothing is reported
+// as ErrCorrupt.
+func TestEmptyWords(t *testing.T) {
+	file := emptyWordFile(t)
+
+	reader, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, reader); !errors.Is(err, ErrHeader) {
+		t.Errorf("Read: got %v, expected ErrHeader", err)
+	}
+	if _, err := Inspect(bytes.NewReader(file), int64(len(file)), ReaderOptions{}); !errors.Is(err, ErrHeader) {
+		t.Errorf("Inspect: got %v, expected ErrHeader", err)
+	}
+
+	table, err := newDecodeTable(map[rune]int{firstWordSymbol: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &wideBlock{alphabet: AlphabetWord, words: [][]byte{{}}, table: table, bits: bitio.NewReader(bytes.NewReader(nil))}
+	if _, err := block.decode(make([]byte, 10)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("decode: got %v, expected ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,337 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The symbols of a MethodBWT block after move-to-front: runs of zeros are
+// written as bijective base-2 numbers, least significant digit first, with
+// the digits runA (1) and runB (2), and every other move-to-front value v as
+// v+1.
+const (
+	runA = iota
+	runB
+
+	numBWTSymbols = 257
+)
+
+// suffixArray returns the rotations of data followed by a sentinel that is
+// smaller than every byte, in sorted order, as the position each rotation
+// starts at. Thanks to the sentinel this is also the order of the suffixes.
+// Rotations are sorted by prefix doubling: after the round for k, class
+// holds the rank of every rotation among the others by its first 2k symbols.
+func suffixArray(data []byte) []int32 {
+
+	n := len(data) + 1
+	symbol := func(i int) int {
+		if i == n-1 {
+			return 0
+		}
+		return int(data[i]) + 1
+	}
+
+	order := make([]int32, n)
+	class := make([]int32, n)
+	counts := make([]int32, max(n, 257))
+
+	for i := 0; i < n; i++ {
+		counts[symbol(i)]++
+	}
+	for i := 1; i < 257; i++ {
+		counts[i] += counts[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		counts[symbol(i)]--
+		order[counts[symbol(i)]] = int32(i)
+	}
+
+	classes := int32(1)
+	for i := 1; i < n; i++ {
+		if symbol(int(order[i])) != symbol(int(order[i-1])) {
+			classes++
+		}
+		class[order[i]] = classes - 1
+	}
+
+	shifted := make([]int32, n)
+	nextClass := make([]int32, n)
+	for k := 1; k < n && int(classes) < n; k <<= 1 {
+		// Sorting the rotations by their second half is a matter of
+		// shifting the current order; a stable counting sort by the first
+		// half then orders them by both.
+		for i, start := range order {
+			shifted[i] = start - int32(k)
+			if shifted[i] < 0 {
+				shifted[i] += int32(n)
+			}
+		}
+
+		clear(counts[:classes])
+		for _, start := range shifted {
+			counts[class[start]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			counts[i] += counts[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			start := shifted[i]
+			counts[class[start]]--
+			order[counts[class[start]]] = start
+		}
+
+		classes = 1
+		nextClass[order[0]] = 0
+		for i := 1; i < n; i++ {
+			current, previous := int(order[i]), int(order[i-1])
+			if class[current] != class[previous] || class[(current+k)%n] != class[(previous+k)%n] {
+				classes++
+			}
+			nextClass[current] = classes - 1
+		}
+		class, nextClass = nextClass, class
+	}
+
+	return order
+}
+
+// bwt returns the Burrows–Wheeler transform of data: the last symbol of
+// every sorted rotation of data and a sentinel, with the sentinel itself left
+// out. primary is the row where the sentinel would be.
+func bwt(data []byte) (transformed []byte, primary int) {
+
+	transformed = make([]byte, 0, len(data))
+	for row, start := range suffixArray(data) {
+		if start == 0 {
+			primary = row
+			continue
+		}
+		transformed = append(transformed, data[start-1])
+	}
+
+	return transformed, primary
+}
+
+// inverseBWT undoes bwt. It returns an error if primary is out of range.
+func inverseBWT(transformed []byte, primary int) ([]byte, error) {
+
+	n := len(transformed) + 1
+	if primary < 0 || primary >= n {
+		return nil, fmt.Errorf("%w: BWT primary index %d out of range", ErrHeader, primary)
+	}
+
+	// next maps every row to the row of the rotation that starts one symbol
+	// earlier, following the last column into the first. The sentinel
+	// sorts first, so the rows starting with byte b follow those starting
+	// with smaller bytes, after row zero.
+	var starts [256]int
+	for _, b := range transformed {
+		starts[b]++
+	}
+	sum := 1
+	for b, count := range starts {
+		starts[b] = sum
+		sum += count
+	}
+
+	next := make([]int32, n)
+	for row := 0; row < n; row++ {
+		if row == primary {
+			continue
+		}
+		b := transformed[row-boolToInt(row > primary)]
+		next[row] = int32(starts[b])
+		starts[b]++
+	}
+
+	// Row zero starts with the sentinel, so its last symbol is the last
+	// byte of the data. Walk back from there.
+	data := make([]byte, len(transformed))
+	row := 0
+	for i := len(data) - 1; i >= 0; i-- {
+		if row == primary {
+			return nil, fmt.Errorf("%w: invalid BWT primary index %d", ErrHeader, primary)
+		}
+		data[i] = transformed[row-boolToInt(row > primary)]
+		row = int(next[row])
+	}
+
+	return data, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// moveToFront replaces every byte with its position in a list of all byte
+// values that starts in order and moves each byte to the front once it has
+// been seen. The runs of equal bytes that bwt produces become runs of zeros.
+func moveToFront(data []byte) []byte {
+
+	var list [256]byte
+	for i := range list {
+		list[i] = byte(i)
+	}
+
+	output := make([]byte, len(data))
+	for i, b := range data {
+		position := bytes.IndexByte(list[:], b)
+		copy(list[1:position+1], list[:position])
+		list[0] = b
+		output[i] = byte(position)
+	}
+
+	return output
+}
+
+// runLengthSymbols turns the output of moveToFront into symbols of the
+// numBWTSymbols alphabet.
+func runLengthSymbols(positions []byte) []rune {
+
+	symbols := make([]rune, 0, len(positions))
+
+	run := 0
+	flushRun := func() {
+		// Write run in bijective base 2: digits of one and two.
+		for run > 0 {
+			if run&1 == 1 {
+				symbols = append(symbols, runA)
+				run = (run - 1) / 2
+			} else {
+				symbols = append(symbols, runB)
+				run = (run - 2) / 2
+			}
+		}
+	}
+
+	for _, position := range positions {
+		if position == 0 {
+			run++
+			continue
+		}
+		flushRun()
+		symbols = append(symbols, rune(position)+1)
+	}
+	flushRun()
+
+	return symbols
+}
+
+// encodeBWTBlock codes data bzip2 style: the Burrows–Wheeler transform
+// gathers bytes with similar contexts, move-to-front turns them into small
+// numbers and mostly zeros, and the runs of zeros are shortened before the
+// symbols go to the entropy coder. The body starts with the BWT primary
+// index as a uint32, followed by the coder's description of the alphabet.
+func encodeBWTBlock(body *bytes.Buffer, data []byte, coder Coder, maxCodeLength int) error {
+
+	transformed, primary := bwt(data)
+	symbols := runLengthSymbols(moveToFront(transformed))
+
+	frequency := make(map[rune]int)
+	for _, symbol := range symbols {
+		frequency[symbol]++
+	}
+
+	if err := binary.Write(body, binary.BigEndian, uint32(primary)); err != nil {
+		return err
+	}
+
+	e, err := coder.entropyCoder().newEncoder(body, []alphabet{{size: numBWTSymbols, frequency: frequency}}, maxCodeLength)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		e.encode(0, symbol)
+	}
+	e.flush()
+
+	return nil
+}
+
+// bwtBlock decodes a block coded by encodeBWTBlock. The whole block is
+// decoded on the first call, since the inverse transform needs all of it.
+type bwtBlock struct {
+	length  int
+	primary int
+	symbols symbolDecoder
+
+	output []byte
+	err    error
+}
+
+func newBWTBlock(body []byte, length int, coder Coder) (*bwtBlock, error) {
+
+	if len(body) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	primary := int(binary.BigEndian.Uint32(body))
+
+	symbols, err := coder.entropyCoder().newDecoder(body[4:], []int{numBWTSymbols})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bwtBlock{length: length, primary: primary, symbols: symbols}, nil
+}
+
+func (b *bwtBlock) decode(p []byte) (int, error) {
+
+	if b.output == nil && b.err == nil {
+		b.output, b.err = b.decodeAll()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n := copy(p, b.output)
+	b.output = b.output[n:]
+
+	return n, nil
+}
+
+func (b *bwtBlock) decodeAll() ([]byte, error) {
+
+	var list [256]byte
+	for i := range list {
+		list[i] = byte(i)
+	}
+
+	transformed := make([]byte, 0, b.length)
+
+	// A run's digits are least significant first, so each one adds its
+	// share of zeros, that is of copies of the front byte, straight away.
+	digit := 1
+	for len(transformed) < b.length {
+		symbol, err := b.symbols.decode(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if symbol == runA || symbol == runB {
+			run := digit << symbol
+			if run > b.length-len(transformed) {
+				return nil, fmt.Errorf("%w: run of %d bytes overflows the block", ErrCorrupt, run)
+			}
+			for i := 0; i < run; i++ {
+				transformed = append(transformed, list[0])
+			}
+			digit <<= 1
+			continue
+		}
+		digit = 1
+
+		position := int(symbol) - 1
+		value := list[position]
+		copy(list[1:position+1], list[:position])
+		list[0] = value
+		transformed = append(transformed, value)
+	}
+
+	return inverseBWT(transformed, b.primary)
+}
@@ -0,0 +1,120 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// naiveSuffixArray sorts the suffixes of data directly.
+func naiveSuffixArray(data []byte) []int32 {
+	order := make([]int32, len(data)+1)
+	for i := range order {
+		order[i] = int32(i)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(data[order[i]:], data[order[j]:]) < 0
+	})
+	return order
+}
+
+func TestSuffixArray(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	inputs := [][]byte{
+		{},
+		[]byte("a"),
+		[]byte("banana"),
+		[]byte("mississippi"),
+		bytes.Repeat([]byte("ab"), 50),
+		bytes.Repeat([]byte{0}, 100),
+	}
+	for i := 0; i < 20; i++ {
+		input := make([]byte, random.Intn(500))
+		for j := range input {
+			input[j] = byte(random.Intn(1 + i%4))
+		}
+		inputs = append(inputs, input)
+	}
+
+	for _, input := range inputs {
+		got, expected := suffixArray(input), naiveSuffixArray(input)
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Fatalf("suffixArray(%q) = %v, expected %v", input, got, expected)
+			}
+		}
+
+		transformed, primary := bwt(input)
+		restored, err := inverseBWT(transformed, primary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(restored, input) {
+			t.Errorf("inverseBWT(bwt(%q)) = %q", input, restored)
+		}
+	}
+}
+
+func TestRunLengthSymbols(t *testing.T) {
+	for run := 1; run <= 20; run++ {
+		symbols := runLengthSymbols(make([]byte, run))
+
+		decoded, digit := 0, 1
+		for _, symbol := range symbols {
+			if symbol != runA && symbol != runB {
+				t.Fatalf("run of %d coded with symbol %d", run, symbol)
+			}
+			decoded += digit << symbol
+			digit <<= 1
+		}
+		if decoded != run {
+			t.Errorf("run of %d coded as %v, which decodes to %d", run, symbols, decoded)
+		}
+	}
+}
+
+func TestBWTRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	noise := make([]byte, 20000)
+	random.Read(noise)
+
+	inputs := map[string][]byte{
+		"single": []byte("a"),
+		"run":    bytes.Repeat([]byte("z"), 100000),
+		"noise":  noise,
+		"text":   benchmarkInput(),
+	}
+
+	for name, input := range inputs {
+		for _, coder := range []Coder{CoderHuffman, CoderRange} {
+			compressed := compressBytes(t, input, WriterOptions{Method: MethodBWT, Coder: coder, BlockSize: 1 << 18})
+
+			reader, err := NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("%s, %v: %v", name, coder, err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("%s, %v: round trip mismatch: got %d bytes, expected %d", name, coder, len(output), len(input))
+			}
+		}
+	}
+}
+
+func TestBWTBeatsLZOnText(t *testing.T) {
+	input := benchmarkInput()
+
+	lzSize := len(compressBytes(t, input, WriterOptions{Method: MethodLZ}))
+	bwtSize := len(compressBytes(t, input, WriterOptions{Method: MethodBWT}))
+
+	if bwtSize >= lzSize {
+		t.Errorf("bwt method wrote %d bytes, lz %d", bwtSize, lzSize)
+	}
+}
@@ -0,0 +1,212 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"fmt"
+)
+
+// Coder selects the entropy coder that turns a block's symbols into bits. It
+// is recorded in the file header next to the Method, so a Reader picks the
+// matching decoder by itself.
+type Coder uint8
+
+const (
+	// CoderHuffman gives every symbol a prefix code of a whole number of
+	// bits.
+	CoderHuffman Coder = iota
+
+	// CoderRange drives a range coder with the same symbol counts. It spends
+	// fractional bits per symbol, which pays off on skewed distributions
+	// where a prefix code wastes up to a bit on every frequent symbol.
+	CoderRange
+)
+
+var coderNames = map[Coder]string{
+	CoderHuffman: "huffman",
+	CoderRange:   "range",
+}
+
+func (c Coder) String() string {
+	if name, ok := coderNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Coder(%d)", uint8(c))
+}
+
+// ParseCoder returns the Coder with the given name.
+func ParseCoder(name string) (Coder, error) {
+	for coder, coderName := range coderNames {
+		if coderName == name {
+			return coder, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown coder %q", name)
+}
+
+func (c Coder) valid() bool {
+	_, ok := coderNames[c]
+	return ok
+}
+
+// entropyCoder returns the implementation of c.
+func (c Coder) entropyCoder() entropyCoder {
+	if c == CoderRange {
+		return rangeCoder{}
+	}
+	return huffmanCoder{}
+}
+
+// alphabet is one of the symbol sets a block is coded with: size symbols
+// numbered from zero, and how often each of them occurs in the block.
+type alphabet struct {
+	size      int
+	frequency map[rune]int
+}
+
+// entropyCoder codes the symbols of a block from statistics gathered
+// beforehand. The encoder writes whatever describes its codes to the front of
+// the body, and the decoder rebuilds the codes from there.
+type entropyCoder interface {
+	newEncoder(body *bytes.Buffer, alphabets []alphabet, maxCodeLength int) (symbolEncoder, error)
+	newDecoder(body []byte, sizes []int) (symbolDecoder, error)
+}
+
+// symbolEncoder writes symbols of the alphabets it was created with,
+// interleaved with raw bits such as the extra bits of a match.
+type symbolEncoder interface {
+	encode(alphabet int, symbol rune)
+	writeBits(value uint64, n uint)
+	flush()
+}
+
+// symbolDecoder reads back what a symbolEncoder wrote, in the same order.
+type symbolDecoder interface {
+	decode(alphabet int) (rune, error)
+	readBits(n uint) (uint64, error)
+}
+
+// huffmanCoder stores one code length byte per symbol of every alphabet, as
+// written by writeCodeLengths, in front of MSB-first canonical codes.
+type huffmanCoder struct{}
+
+type huffmanEncoder struct {
+	bits  *bitio.Writer
+	codes [][]bitio.Code
+}
+
+func (huffmanCoder) newEncoder(body *bytes.Buffer, alphabets []alphabet, maxCodeLength int) (symbolEncoder, error) {
+
+	e := &huffmanEncoder{codes: make([][]bitio.Code, len(alphabets))}
+
+	for i, a := range alphabets {
+		if len(a.frequency) > 1<<maxCodeLength {
+			return nil, fmt.Errorf("huffman: %d symbols cannot be coded in %d bits", len(a.frequency), maxCodeLength)
+		}
+
+		lengths := limitCodeLengths(a.frequency, maxCodeLength)
+		writeCodeLengths(body, lengths, a.size)
+		e.codes[i] = codeTable(lengths, a.size)
+	}
+
+	e.bits = bitio.NewWriter(body)
+
+	return e, nil
+}
+
+func (e *huffmanEncoder) encode(alphabet int, symbol rune) {
+	e.bits.WriteCode(e.codes[alphabet][symbol])
+}
+
+func (e *huffmanEncoder) writeBits(value uint64, n uint) {
+	e.bits.WriteBits(value, n)
+}
+
+// flush ignores the error of Flush, since the body is a bytes.Buffer.
+func (e *huffmanEncoder) flush() {
+	e.bits.Flush()
+}
+
+type huffmanDecoder struct {
+	bits *bitio.Reader
+
+	// tables holds a decode table for every alphabet, nil for one that no
+	// symbol of the block was coded with.
+	tables []*decodeTable
+}
+
+func (huffmanCoder) newDecoder(body []byte, sizes []int) (symbolDecoder, error) {
+
+	reader := bytes.NewReader(body)
+	d := &huffmanDecoder{tables: make([]*decodeTable, len(sizes))}
+
+	for i, size := range sizes {
+		lengths, err := readCodeLengths(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		if len(lengths) == 0 {
+			continue
+		}
+		if d.tables[i], err = newDecodeTable(lengths); err != nil {
+			return nil, err
+		}
+	}
+
+	d.bits = bitio.NewReader(reader)
+
+	return d, nil
+}
+
+func (d *huffmanDecoder) decode(alphabet int) (rune, error) {
+	if d.tables[alphabet] == nil {
+		return 0, errInvalidCode
+	}
+	return d.tables[alphabet].decodeOne(d.bits)
+}
+
+func (d *huffmanDecoder) readBits(n uint) (uint64, error) {
+	return d.bits.ReadBits(n)
+}
+
+// encodeSymbolBlock codes every byte of data as a symbol of a single
+// 256-symbol alphabet. MethodHuffman uses it with coders other than
+// CoderHuffman, which keeps the more compact table of encodeStaticBlock.
+func encodeSymbolBlock(body *bytes.Buffer, data []byte, coder Coder, maxCodeLength int) error {
+
+	e, err := coder.entropyCoder().newEncoder(body, []alphabet{{size: 256, frequency: createFrequencyMap(data)}}, maxCodeLength)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range data {
+		e.encode(0, rune(b))
+	}
+	e.flush()
+
+	return nil
+}
+
+// symbolBlock decodes a block coded by encodeSymbolBlock.
+type symbolBlock struct {
+	symbols symbolDecoder
+}
+
+func newSymbolBlock(body []byte, coder Coder) (*symbolBlock, error) {
+	symbols, err := coder.entropyCoder().newDecoder(body, []int{256})
+	if err != nil {
+		return nil, err
+	}
+	return &symbolBlock{symbols: symbols}, nil
+}
+
+func (b *symbolBlock) decode(p []byte) (int, error) {
+	for i := range p {
+		symbol, err := b.symbols.decode(0)
+		if err != nil {
+			return i, err
+		}
+		p[i] = byte(symbol)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,313 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	// maxContextTables is the most Huffman tables a MethodContext block may
+	// use. The 256 preceding-byte contexts are clustered down to this many.
+	maxContextTables = 32
+
+	// contextBytesPerTable is how much input each table has to pay for: a
+	// block gets one table for every contextBytesPerTable bytes, so small
+	// blocks are not swamped by their own tables.
+	contextBytesPerTable = 8192
+
+	// contextClusterPasses is the number of refinement passes that move
+	// every context to the table that codes it most cheaply.
+	contextClusterPasses = 6
+
+	// contextLoneSymbol stands for the empty code of a table holding a
+	// single symbol in the lengths alphabet; zero stands for an unused
+	// symbol and other values for themselves.
+	contextLoneSymbol = maxCodeLengthLimit + 1
+
+	// contextLengthBits is the width of each code length of the lengths
+	// alphabet, whose codes are at most contextMaxLengthCode bits long.
+	contextLengthBits    = 5
+	contextMaxLengthCode = 15
+)
+
+// contextCounts holds, for every preceding byte, how often each byte follows
+// it. The first byte of a block is counted under context zero.
+type contextCounts [256][256]int
+
+func countContexts(data []byte) *contextCounts {
+	counts := new(contextCounts)
+	previous := byte(0)
+	for _, b := range data {
+		counts[previous][b]++
+		previous = b
+	}
+	return counts
+}
+
+// clusterContexts groups the contexts that occur in a block into at most
+// numTables clusters of similar statistics, in the way bzip2 picks its
+// tables: clusters are seeded with the busiest contexts, and every pass
+// moves each context to the cluster whose current statistics code it in
+// the fewest bits. It returns the cluster of every context and the symbol
+// counts of every non-empty cluster.
+func clusterContexts(counts *contextCounts, numTables int) ([256]uint8, []map[rune]int) {
+
+	var totals [256]int
+	var contexts []int
+	for context := range counts {
+		for _, count := range counts[context] {
+			totals[context] += count
+		}
+		if totals[context] > 0 {
+			contexts = append(contexts, context)
+		}
+	}
+	sort.SliceStable(contexts, func(i, j int) bool {
+		return totals[contexts[i]] > totals[contexts[j]]
+	})
+
+	numTables = min(numTables, len(contexts))
+
+	var assignment [256]uint8
+	clusters := make([][256]int, numTables)
+	for k := range clusters {
+		clusters[k] = counts[contexts[k]]
+	}
+
+	cost := make([][256]float64, numTables)
+	for pass := 0; pass < contextClusterPasses; pass++ {
+		for k := range clusters {
+			total := 0
+			for _, count := range clusters[k] {
+				total += count
+			}
+			for symbol, count := range clusters[k] {
+				cost[k][symbol] = -math.Log2((float64(count) + 0.5) / (float64(total) + 128))
+			}
+		}
+
+		for _, context := range contexts {
+			best, bestCost := 0, math.Inf(1)
+			for k := range clusters {
+				bits := 0.0
+				for symbol, count := range counts[context] {
+					if count > 0 {
+						bits += float64(count) * cost[k][symbol]
+					}
+				}
+				if bits < bestCost {
+					best, bestCost = k, bits
+				}
+			}
+			assignment[context] = uint8(best)
+		}
+
+		clusters = make([][256]int, numTables)
+		for _, context := range contexts {
+			for symbol, count := range counts[context] {
+				clusters[assignment[context]][symbol] += count
+			}
+		}
+	}
+
+	// Drop the clusters that ended up empty and renumber the rest.
+	var renumber [maxContextTables]uint8
+	var frequencies []map[rune]int
+	for k := range clusters {
+		frequency := make(map[rune]int)
+		for symbol, count := range clusters[k] {
+			if count > 0 {
+				frequency[rune(symbol)] = count
+			}
+		}
+		if len(frequency) > 0 {
+			renumber[k] = uint8(len(frequencies))
+			frequencies = append(frequencies, frequency)
+		}
+	}
+	for context := range assignment {
+		if totals[context] > 0 {
+			assignment[context] = renumber[assignment[context]]
+		} else {
+			assignment[context] = 0
+		}
+	}
+
+	return assignment, frequencies
+}
+
+// encodeContextBlock codes every byte with a Huffman table chosen by the byte
+// before it. The body holds the number of tables, the table of each of the
+// 256 contexts, and then a bitstream with the code lengths of all tables,
+// themselves Huffman coded by writeContextTables, followed by the codes.
+func encodeContextBlock(body *bytes.Buffer, data []byte, maxCodeLength int) error {
+
+	numTables := min(maxContextTables, max(1, len(data)/contextBytesPerTable))
+	assignment, frequencies := clusterContexts(countContexts(data), numTables)
+
+	tables := make([]map[rune]int, len(frequencies))
+	codes := make([][]bitio.Code, len(frequencies))
+	for k, frequency := range frequencies {
+		if len(frequency) > 1<<maxCodeLength {
+			return fmt.Errorf("huffman: %d symbols cannot be coded in %d bits", len(frequency), maxCodeLength)
+		}
+		tables[k] = limitCodeLengths(frequency, maxCodeLength)
+		codes[k] = codeTable(tables[k], 256)
+	}
+
+	body.WriteByte(byte(len(tables)))
+	body.Write(assignment[:])
+
+	bw := bitio.NewWriter(body)
+	writeContextTables(bw, tables)
+
+	previous := byte(0)
+	for _, b := range data {
+		bw.WriteCode(codes[assignment[previous]][b])
+		previous = b
+	}
+	bw.Flush()
+
+	return nil
+}
+
+// writeContextTables writes the code length of every byte in every table.
+// Most bytes are unused in most tables, so the lengths are coded with a
+// Huffman code of their own, whose lengths come first in
+// contextLengthBits-bit fields.
+func writeContextTables(bw *bitio.Writer, tables []map[rune]int) {
+
+	values := make([][256]int, len(tables))
+	valueFrequency := make(map[rune]int)
+	for k, lengths := range tables {
+		for symbol, length := range lengths {
+			values[k][symbol] = length
+			if length == 0 {
+				values[k][symbol] = contextLoneSymbol
+			}
+		}
+		for _, value := range values[k] {
+			valueFrequency[rune(value)]++
+		}
+	}
+
+	valueLengths := limitCodeLengths(valueFrequency, contextMaxLengthCode)
+	for value := 0; value <= contextLoneSymbol; value++ {
+		length, used := valueLengths[rune(value)]
+		if used && length == 0 {
+			length = 1<<contextLengthBits - 1
+		}
+		bw.WriteBits(uint64(length), contextLengthBits)
+	}
+
+	valueCodes := codeTable(valueLengths, contextLoneSymbol+1)
+	for k := range values {
+		for _, value := range values[k] {
+			bw.WriteCode(valueCodes[value])
+		}
+	}
+}
+
+// readContextTables reads the numTables tables written by writeContextTables.
+func readContextTables(br *bitio.Reader, numTables int) ([]*decodeTable, error) {
+
+	valueLengths := make(map[rune]int)
+	for value := 0; value <= contextLoneSymbol; value++ {
+		length, err := br.ReadBits(contextLengthBits)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case length == 1<<contextLengthBits-1:
+			valueLengths[rune(value)] = 0
+		case length > contextMaxLengthCode:
+			return nil, fmt.Errorf("%w: code length %d exceeds %d bits", ErrHeader, length, contextMaxLengthCode)
+		case length > 0:
+			valueLengths[rune(value)] = int(length)
+		}
+	}
+	if len(valueLengths) == 0 {
+		return nil, fmt.Errorf("%w: empty context tables", ErrHeader)
+	}
+
+	valueTable, err := newDecodeTable(valueLengths)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]*decodeTable, numTables)
+	for k := range tables {
+		lengths := make(map[rune]int)
+		for symbol := 0; symbol < 256; symbol++ {
+			value, err := valueTable.decodeOne(br)
+			if err != nil {
+				return nil, err
+			}
+			switch value {
+			case 0:
+			case contextLoneSymbol:
+				lengths[rune(symbol)] = 0
+			default:
+				lengths[rune(symbol)] = int(value)
+			}
+		}
+		if len(lengths) == 0 {
+			return nil, fmt.Errorf("%w: empty context table", ErrHeader)
+		}
+
+		if tables[k], err = newDecodeTable(lengths); err != nil {
+			return nil, err
+		}
+	}
+
+	return tables, nil
+}
+
+// contextBlock decodes a block coded by encodeContextBlock.
+type contextBlock struct {
+	contexts [256]*decodeTable
+	bits     *bitio.Reader
+	previous byte
+}
+
+func newContextBlock(body []byte) (*contextBlock, error) {
+
+	if len(body) < 1+256 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	numTables := int(body[0])
+	if numTables == 0 || numTables > maxContextTables {
+		return nil, fmt.Errorf("%w: %d context tables", ErrHeader, numTables)
+	}
+
+	b := &contextBlock{bits: bitio.NewReader(bytes.NewReader(body[1+256:]))}
+
+	tables, err := readContextTables(b.bits, numTables)
+	if err != nil {
+		return nil, err
+	}
+	for context, k := range body[1 : 1+256] {
+		if int(k) >= numTables {
+			return nil, fmt.Errorf("%w: context %d refers to table %d of %d", ErrHeader, context, k, numTables)
+		}
+		b.contexts[context] = tables[k]
+	}
+
+	return b, nil
+}
+
+func (b *contextBlock) decode(p []byte) (int, error) {
+	for i := range p {
+		symbol, err := b.contexts[b.previous].decodeOne(b.bits)
+		if err != nil {
+			return i, err
+		}
+		p[i] = byte(symbol)
+		b.previous = byte(symbol)
+	}
+	return len(p), nil
+}
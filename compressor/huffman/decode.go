@@ -1,83 +1,526 @@
 package huffman
 
 import (
+	"bufio"
+	"bytes"
+	"compressor/bitio"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"os"
 )
 
-func Decode(filename string) error {
+// Decode decompresses filename into outputFilename, restoring the
+// permissions and modification time recorded in the header. A damaged file,
+// or one breaking the limits in options, leaves no output behind.
+func Decode(filename string, outputFilename string, options ReaderOptions) error {
 
-	numCharacters, prefixTable, err := readHeader(filename)
+	inputFile, err := os.Open(filename)
 	if err != nil {
 		return err
 	}
+	defer inputFile.Close()
 
-	fmt.Println(numCharacters)
-	fmt.Println(prefixTable)
+	reader, err := NewReaderOptions(inputFile, options)
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	if _, err := io.Copy(outputFile, reader); err != nil {
+		outputFile.Close()
+		os.Remove(outputFilename)
+		return err
+	}
+
+	if reader.Mode != 0 {
+		if err := outputFile.Chmod(reader.Mode.Perm()); err != nil {
+			return err
+		}
+	}
+
+	if err := outputFile.Close(); err != nil {
+		return err
+	}
+
+	if !reader.ModTime.IsZero() {
+		return os.Chtimes(outputFilename, reader.ModTime, reader.ModTime)
+	}
 
 	return nil
 }
 
-func readHeader(filename string) (int, map[rune]string, error) {
+// ReaderOptions limits how much a Reader will decompress, guarding against
+// input crafted to expand without bound. The zero value sets no limits.
+//
+// The limits are checked against the length a block header claims, before
+// the block is decoded, so a Reader never decodes a block that would break
+// them and stops at the end of the last block that fits. A gzip stream,
+// whose blocks record no length, is checked as it is inflated and cut off at
+// exactly MaxSize. Recover and Inspect count all the data too, while a
+// ReaderAt, which decodes blocks independently, holds each block to the
+// limits on its own: it refuses a block longer than MaxSize however few of
+// its bytes are asked for.
+type ReaderOptions struct {
+	// MaxSize is the largest number of bytes the Reader will produce. Zero
+	// means no limit.
+	MaxSize int64
+
+	// MaxRatio is the largest number of bytes the Reader will produce for
+	// each compressed byte read. Zero means no limit. Runs of a single byte
+	// legitimately compress by a factor of thousands, so it is only a guard
+	// against blocks that claim far more data than their size could hold.
+	MaxRatio int64
+}
+
+// A LimitError reports that decompression stopped at a limit set in
+// ReaderOptions. Size is how much original data decompression had reached,
+// or a block claimed, and Compressed how many compressed bytes held it.
+type LimitError struct {
+	Limit      string
+	Size       int64
+	Compressed int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("huffman: %d bytes of original data from %d compressed bytes exceed %s", e.Size, e.Compressed, e.Limit)
+}
+
+// check returns a *LimitError if size bytes of original data decompressed
+// from compressed bytes break either limit.
+func (options ReaderOptions) check(size, compressed int64) error {
+	if options.MaxSize > 0 && size > options.MaxSize {
+		return &LimitError{Limit: fmt.Sprintf("MaxSize of %d bytes", options.MaxSize), Size: size, Compressed: compressed}
+	}
+	if options.MaxRatio > 0 && size > options.MaxRatio*compressed {
+		return &LimitError{Limit: fmt.Sprintf("MaxRatio of %d", options.MaxRatio), Size: size, Compressed: compressed}
+	}
+	return nil
+}
+
+// A Reader is an io.Reader that decompresses a stream produced by Writer.
+// Blocks are read and decoded one at a time. A block that cannot be decoded,
+// or whose data does not match its checksum, is reported as a *BlockError
+// by the Read that reaches its end, so no more than one block of damaged data
+// is passed on. The size and checksum in the trailer are verified once the
+// last block has been read, and a mismatch is reported as ErrChecksum. Gzip streams,
+// whether written by Writer or by any other gzip implementation, are
+// recognised by their magic number and decoded as well.
+type Reader struct {
+	// Header describes the original file, as far as the compressed file
+	// records it.
+	Header
+
+	r       *bufio.Reader
+	input   *countingReader
+	options ReaderOptions
+	gzip    *gzipReader
+	header  fileHeader
+	size    uint64
+	digest  hash.Hash32
+
+	// The block being decoded and the number of its bytes still to come.
+	block     *block
+	remaining int
+
+	// blockChecksum is the CRC-32 of the block's bytes decoded so far, and
+	// blocks the number of blocks read. offset is where the block starts in
+	// the file and start the offset of its first original byte.
+	blockChecksum uint32
+	blocks        int
+	offset        int64
+	start         uint64
+
+	err error
+}
+
+// NewReader returns a Reader that decompresses r. It reads and validates the
+// file header, so an unrecognised stream is reported here rather than on Read.
+func NewReader(r io.Reader) (*Reader, error) {
+	return NewReaderOptions(r, ReaderOptions{})
+}
 
-	file, err := os.Open(filename)
+// NewReaderOptions is like NewReader but stops with a *LimitError when the
+// decompressed data would break the given limits. Blocks of the native
+// format are checked against them before they are decoded.
+func NewReaderOptions(r io.Reader, options ReaderOptions) (*Reader, error) {
+
+	input := &countingReader{r: r}
+	reader := bufio.NewReader(input)
+
+	if id, _ := reader.Peek(2); len(id) == 2 && id[0] == gzipID1 && id[1] == gzipID2 {
+		reader.Discard(2)
+		gzip, err := newGzipReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{Header: gzip.header, r: reader, input: input, options: options, gzip: gzip}, nil
+	}
+
+	header, err := readFileHeader(reader)
 	if err != nil {
-		return 0, nil, err
+		return nil, err
+	}
+
+	return &Reader{
+		Header:  header.metadata,
+		r:       reader,
+		input:   input,
+		options: options,
+		header:  header,
+		digest:  crc32.NewIEEE(),
+		offset:  header.size(),
+	}, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Read decompresses up to len(p) bytes into p.
+func (z *Reader) Read(p []byte) (int, error) {
+
+	if z.gzip != nil {
+		return z.readGzip(p)
+	}
+
+	n := 0
+	for n < len(p) && z.err == nil {
+		if z.remaining == 0 {
+			z.err = z.nextBlock()
+			continue
+		}
+
+		decoded, err := z.block.decode(p[n:min(len(p), n+z.remaining)])
+		z.digest.Write(p[n : n+decoded])
+		z.blockChecksum = crc32.Update(z.blockChecksum, crc32.IEEETable, p[n:n+decoded])
+		z.size += uint64(decoded)
+		z.remaining -= decoded
+		n += decoded
+		if err == nil && z.remaining == 0 && z.blockChecksum != z.block.checksum {
+			err = ErrChecksum
+		}
+		if err != nil {
+			err = z.blockError(err)
+		}
+		z.err = err
 	}
 
-	var numCharacters uint32
-	if err := binary.Read(file, binary.BigEndian, &numCharacters); err != nil {
-		return 0, nil, err
+	if n > 0 && z.err == io.EOF {
+		return n, nil
 	}
 
-	fmt.Println(numCharacters)
+	return n, z.err
+}
 
-	prefixTable := make(map[rune]string)
+// readGzip decompresses a gzip stream, whose blocks do not record their
+// length, so the limits are checked against the data as it is produced.
+func (z *Reader) readGzip(p []byte) (int, error) {
+
+	if z.err != nil {
+		return 0, z.err
+	}
 
-	for i := uint32(0); i < numCharacters; i++ {
-		var char uint8
-		if err := binary.Read(file, binary.BigEndian, &char); err != nil {
-			return 0, nil, err
+	n, err := z.gzip.Read(p)
+	size := int64(z.gzip.total)
+	if limitErr := z.options.check(size, z.input.n-int64(z.r.Buffered())); limitErr != nil {
+		if z.options.MaxSize > 0 && size > z.options.MaxSize {
+			n -= int(size - z.options.MaxSize)
 		}
+		z.err = limitErr
+		return max(n, 0), limitErr
+	}
+
+	return n, err
+}
+
+// nextBlock reads the next block. After the last block it verifies the
+// trailer and returns io.EOF.
+func (z *Reader) nextBlock() error {
+
+	if z.block != nil {
+		z.blocks++
+		z.offset += z.block.size
+	}
+	z.start = z.size
+
+	block, err := readBlock(z.r, z.header)
+	if err != nil {
+		z.block = nil
+		return z.blockError(err)
+	}
+	if block == nil {
+		return z.verifyTrailer()
+	}
+	if block.start != z.size {
+		z.block = nil
+		return z.blockError(fmt.Errorf("%w: block recorded at original offset %d", ErrHeader, block.start))
+	}
+	if err := z.options.check(int64(z.size)+int64(block.length), z.offset+block.size); err != nil {
+		z.block = nil
+		return err
+	}
 
-		fmt.Println(char)
+	z.block = block
+	z.remaining = block.length
+	z.blockChecksum = 0
 
-		var codeLength uint8
-		if err := binary.Read(file, binary.BigEndian, &codeLength); err != nil {
-			return 0, nil, err
+	return nil
+}
+
+// blockError reports err as found in the current block.
+func (z *Reader) blockError(err error) error {
+	return &BlockError{Block: z.blocks, Offset: z.offset, Start: int64(z.start), Err: err}
+}
+
+// block is a block read into memory, ready to be decoded. start is the
+// offset of its first original byte, size its length in the compressed file
+// and checksum the CRC-32 of its original data.
+type block struct {
+	length   int
+	start    uint64
+	size     int64
+	checksum uint32
+	decoder  blockDecoder
+}
+
+// blockDecoder decodes the body of one block. Each call fills p with the
+// next symbols, and the caller never asks for more than the block holds.
+type blockDecoder interface {
+	decode(p []byte) (int, error)
+}
+
+// readBlock reads the block starting at the current position of r, or
+// returns a nil block if r is at the end-of-blocks marker.
+func readBlock(r io.Reader, header fileHeader) (*block, error) {
+
+	h, err := readBlockHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if h.length == 0 {
+		return nil, nil
+	}
+	length := h.length
+
+	// Grow the body as it arrives, so that a header claiming a huge block
+	// cannot allocate more than the input actually holds.
+	var buffer bytes.Buffer
+	buffer.Grow(int(min(h.size, DefaultBlockSize)))
+	if _, err := io.CopyN(&buffer, r, int64(h.size)); err != nil {
+		return nil, noEOF(err)
+	}
+	body := buffer.Bytes()
+
+	var decoder blockDecoder
+	switch {
+	case h.flags&blockStored != 0:
+		decoder = &storedBlock{data: body}
+	case header.method == MethodAdaptive:
+		decoder = &adaptiveBlock{tree: newAdaptiveTree(), bits: bitio.NewReader(bytes.NewReader(body))}
+	case header.method == MethodContext:
+		contextDecoder, err := newContextBlock(body)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = contextDecoder
+	case header.method == MethodBWT:
+		bwtDecoder, err := newBWTBlock(body, int(length), header.coder)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = bwtDecoder
+	case header.method == MethodLZ:
+		lzDecoder, err := newLZBlock(body, int(length), header.coder)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = lzDecoder
+	case header.alphabet != AlphabetByte:
+		wideDecoder, err := newWideBlock(body, header.alphabet)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = wideDecoder
+	case header.coder != CoderHuffman:
+		symbolDecoder, err := newSymbolBlock(body, header.coder)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = symbolDecoder
+	default:
+		staticDecoder, err := newStaticBlock(body)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		decoder = staticDecoder
+	}
+
+	return &block{length: int(length), start: h.start, size: blockHeaderSize + int64(h.size), checksum: h.checksum, decoder: decoder}, nil
+}
+
+// decode fills p with the next original bytes of the block.
+func (b *block) decode(p []byte) (int, error) {
+	n, err := b.decoder.decode(p)
+	return n, bodyError(err)
+}
+
+// bodyError reports a block body whose symbols run past its end as corrupt.
+// The body has been read in full by then, so unlike a short file this is not
+// truncation.
+func bodyError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, bitio.ErrOverrun) {
+		return fmt.Errorf("%w: block body ends early", ErrCorrupt)
+	}
+	return err
+}
+
+// storedBlock decodes a block whose body is its original data.
+type storedBlock struct {
+	data []byte
+}
+
+func (b *storedBlock) decode(p []byte) (int, error) {
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+// staticBlock decodes a block coded by encodeStaticBlock.
+type staticBlock struct {
+	table *decodeTable
+	bits  *bitio.Reader
+}
+
+func newStaticBlock(body []byte) (*staticBlock, error) {
+
+	reader := bytes.NewReader(body)
+
+	lengths, err := readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := newDecodeTable(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticBlock{
+		table: table,
+		bits:  bitio.NewReader(reader),
+	}, nil
+}
+
+// decode fills p with the block's next symbols, resolving up to two symbols
+// per table probe. Running into the padding past the end of the body is
+// only checked once, when the loop is done.
+func (b *staticBlock) decode(p []byte) (int, error) {
+
+	table := b.table
+	if table.single {
+		for i := range p {
+			p[i] = byte(table.singleSym)
+		}
+		return len(p), nil
+	}
+
+	br := b.bits
+	primaryBits := table.primaryBits
+
+	n := 0
+	for n < len(p) {
+		if br.Buffered() < table.maxLength {
+			br.Fill()
+		}
+
+		entry := &table.primary[br.Peek(primaryBits)]
+		if entry.link >= 0 {
+			sub := &table.secondary[entry.link]
+			entry = &sub.entries[br.Peek(primaryBits+sub.bits)&(1<<sub.bits-1)]
+		}
+		if entry.count == 0 {
+			return n, errInvalidCode
 		}
 
-		fmt.Println(codeLength)
+		p[n] = byte(entry.symbols[0])
+		n++
 
-		var code string
-		for j := uint8(0); j < codeLength-6; j++ {
-			var bit byte
-			if err := binary.Read(file, binary.BigEndian, &bit); err != nil {
-				fmt.Println(filename)
-				return 0, nil, err
-			}
-			if bit == 1 {
-				code += "1"
-			} else {
-				code += "0"
-			}
+		if entry.count == 2 && n < len(p) {
+			p[n] = byte(entry.symbols[1])
+			n++
+			br.Consume(uint(entry.length))
+		} else {
+			br.Consume(uint(entry.firstLength))
 		}
+	}
+
+	return n, br.Consume(0)
+}
+
+// verifyTrailer checks the size and checksum that follow the last block.
+func (z *Reader) verifyTrailer() error {
+
+	t, err := readTrailer(z.r)
+	if err != nil {
+		return err
+	}
 
-		prefixTable[rune(char)] = code
+	if t.size != z.size || t.checksum != z.digest.Sum32() {
+		return ErrChecksum
 	}
 
-	fmt.Println(filename, prefixTable)
+	return io.EOF
+}
+
+// readHeader reads the code lengths written by writeHeader. The canonical
+// codes are rebuilt from them by newDecodeTable.
+func readHeader(inputFile io.Reader) (map[rune]int, error) {
 
-	var endMarker uint16
-	if err := binary.Read(file, binary.BigEndian, &endMarker); err != nil {
-		return 0, nil, err
+	var numSymbols uint16
+	if err := binary.Read(inputFile, binary.BigEndian, &numSymbols); err != nil {
+		return nil, noEOF(err)
 	}
-	if endMarker != 0xFFFF {
-		return 0, nil, fmt.Errorf("invalid end-of-header marker %v %v", endMarker, 0xFFFF)
+	if numSymbols == 0 || numSymbols > 256 {
+		return nil, fmt.Errorf("%w: %d symbols in prefix table", ErrHeader, numSymbols)
 	}
 
-	fmt.Println(filename)
+	lengths := make(map[rune]int, numSymbols)
+
+	previousChar := -1
+	for i := uint16(0); i < numSymbols; i++ {
+		var entry [2]uint8
+		if err := binary.Read(inputFile, binary.BigEndian, &entry); err != nil {
+			return nil, noEOF(err)
+		}
+
+		char, codeLength := int(entry[0]), int(entry[1])
+		if char <= previousChar {
+			return nil, fmt.Errorf("%w: symbols out of order in prefix table", ErrHeader)
+		}
+		if codeLength > maxCodeLengthLimit {
+			return nil, fmt.Errorf("%w: code length %d exceeds %d bits", ErrHeader, codeLength, maxCodeLengthLimit)
+		}
+		previousChar = char
+
+		lengths[rune(char)] = codeLength
+	}
 
-	return int(numCharacters), prefixTable, nil
+	return lengths, nil
 }
@@ -0,0 +1,491 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+// TestEncodeDecodeRoundTrip compresses and decompresses a few inputs and checks
+// that the restored file matches the original byte for byte.
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty":  {},
+		"single": []byte("aaaaaaa"),
+		"simple": []byte("aaaab"),
+		"text":   []byte("the quick brown fox jumps over the lazy dog\n"),
+		"binary": {0, 1, 2, 255, 254, 0, 0, 0, 128, 7},
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputFilename := filepath.Join(dir, "input")
+			compressedFilename := filepath.Join(dir, "compressed.bin")
+			outputFilename := filepath.Join(dir, "output")
+
+			if err := os.WriteFile(inputFilename, input, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := Encode(inputFilename, compressedFilename, WriterOptions{}); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if err := Decode(compressedFilename, outputFilename, ReaderOptions{}); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			output, err := os.ReadFile(outputFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("round trip mismatch.\nGot: %v\nExpected: %v", output, input)
+			}
+		})
+	}
+}
+
+// TestDecodeRejectsUnrecognisedFiles checks that damaged or foreign files are
+// rejected with the matching error instead of producing garbage.
+func TestDecodeRejectsUnrecognisedFiles(t *testing.T) {
+	dir := t.TempDir()
+	inputFilename := filepath.Join(dir, "input")
+	compressedFilename := filepath.Join(dir, "compressed.bin")
+
+	if err := os.WriteFile(inputFilename, []byte("the quick brown fox jumps over the lazy dog\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(inputFilename, compressedFilename, WriterOptions{}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	compressed, err := os.ReadFile(compressedFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := func(offset int, mask byte) []byte {
+		data := bytes.Clone(compressed)
+		data[offset] ^= mask
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"bad magic", corrupt(0, 0x01), ErrFormat},
+		{"bad version", corrupt(4, 0x01), ErrVersion},
+		{"unknown flags", corrupt(5, 0x80), ErrHeader},
+		{"bad checksum", corrupt(len(compressed)-1, 0x01), ErrChecksum},
+		{"not compressed", []byte("plain text"), ErrFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			damagedFilename := filepath.Join(dir, "damaged.bin")
+			if err := os.WriteFile(damagedFilename, test.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Decode(damagedFilename, filepath.Join(dir, "output"), ReaderOptions{})
+			if !errors.Is(err, test.expected) {
+				t.Errorf("Decode error = %v, expected %v", err, test.expected)
+			}
+		})
+	}
+}
+
+// TestWriterReaderStreaming compresses in several writes and decompresses
+// through a one-byte-at-a-time reader, so no step can rely on seeing the whole
+// stream at once.
+func TestWriterReaderStreaming(t *testing.T) {
+	input := bytes.Repeat([]byte("streaming huffman data, "), 100)
+
+	var compressed bytes.Buffer
+	writer := NewWriter(&compressed)
+	for start := 0; start < len(input); start += 7 {
+		if _, err := writer.Write(input[start:min(start+7, len(input))]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := writer.Write([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write after Close error = %v, expected %v", err, ErrClosed)
+	}
+
+	reader, err := NewReader(iotest.OneByteReader(&compressed))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	output, err := io.ReadAll(iotest.OneByteReader(reader))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Errorf("round trip mismatch: got %d bytes, expected %d", len(output), len(input))
+	}
+}
+
+// TestWriterBlocks round-trips input spanning many blocks and checks that the
+// output does not depend on how many blocks are encoded in parallel.
+func TestWriterBlocks(t *testing.T) {
+	var input []byte
+	for i := 0; i < 50; i++ {
+		input = append(input, bytes.Repeat([]byte{byte('a' + i%7), byte(i)}, 100+i*10)...)
+	}
+
+	var expected []byte
+	for _, concurrency := range []int{1, 2, 8} {
+		compressed := compressBytes(t, input, WriterOptions{BlockSize: 1000, Concurrency: concurrency})
+		if expected == nil {
+			expected = compressed
+		} else if !bytes.Equal(compressed, expected) {
+			t.Errorf("concurrency %d changed the output", concurrency)
+		}
+
+		reader, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", concurrency, err)
+		}
+		if !bytes.Equal(output, input) {
+			t.Errorf("concurrency %d: round trip mismatch: got %d bytes, expected %d", concurrency, len(output), len(input))
+		}
+	}
+}
+
+// TestBlockChecksum damages one block of a file and checks that both readers
+// name that block, and that Decode leaves no output behind.
+func TestBlockChecksum(t *testing.T) {
+	input := bytes.Repeat([]byte("every block carries its own checksum\n"), 200)
+	compressed := compressBytes(t, input, WriterOptions{BlockSize: 1000})
+
+	entries, err := scanBlocks(bytes.NewReader(compressed), fileHeaderSize, int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := entries[2]
+
+	// Rewrite the block header with a different checksum, so the block
+	// decodes cleanly but does not match it.
+	h, err := readBlockHeader(bytes.NewReader(compressed[damaged.offset:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.checksum ^= 1
+	var header bytes.Buffer
+	writeBlockHeader(&header, h)
+	data := bytes.Clone(compressed)
+	copy(data[damaged.offset:], header.Bytes())
+
+	checkError := func(name string, err error) {
+		t.Helper()
+		var blockErr *BlockError
+		if !errors.As(err, &blockErr) || !errors.Is(err, ErrChecksum) {
+			t.Fatalf("%s error = %v, expected a block checksum mismatch", name, err)
+		}
+		if blockErr.Block != 2 || blockErr.Offset != damaged.offset || blockErr.Start != damaged.start {
+			t.Errorf("%s reported block %d at %d from %d, expected block 2 at %d from %d",
+				name, blockErr.Block, blockErr.Offset, blockErr.Start, damaged.offset, damaged.start)
+		}
+	}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	checkError("Reader", err)
+	if int64(len(output)) > damaged.start+int64(damaged.length) {
+		t.Errorf("Reader passed on %d bytes, past the end of the damaged block", len(output))
+	}
+
+	readerAt, err := NewReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readerAt.ReadAt(make([]byte, 10), damaged.start+5)
+	checkError("ReaderAt", err)
+
+	dir := t.TempDir()
+	damagedFilename := filepath.Join(dir, "damaged.bin")
+	outputFilename := filepath.Join(dir, "output")
+	if err := os.WriteFile(damagedFilename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkError("Decode", Decode(damagedFilename, outputFilename, ReaderOptions{}))
+	if _, err := os.Stat(outputFilename); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Decode left output behind: %v", err)
+	}
+}
+
+// TestCorruptBlocks damages the first block of a file in every method, coder
+// and alphabet, and checks that the readers report a body cut short as
+// ErrCorrupt and any flipped byte as one of the typed errors.
+func TestCorruptBlocks(t *testing.T) {
+	input := bytes.Repeat([]byte("a block body cut short is corrupt, not truncated\n"), 20)
+
+	for _, options := range []WriterOptions{
+		{},
+		{Method: MethodAdaptive},
+		{Method: MethodContext},
+		{Method: MethodLZ},
+		{Method: MethodLZ, Coder: CoderRange},
+		{Method: MethodBWT},
+		{Method: MethodBWT, Coder: CoderRange},
+		{Coder: CoderRange},
+		{Alphabet: AlphabetRune},
+		{Alphabet: AlphabetWord},
+		{Alphabet: AlphabetExtended},
+	} {
+		name := fmt.Sprintf("%v/%v/%v", options.Method, options.Coder, options.Alphabet)
+		compressed := compressBytes(t, input, options)
+
+		entries, err := scanBlocks(bytes.NewReader(compressed), fileHeaderSize, int64(len(compressed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset := entries[0].offset
+		h, err := readBlockHeader(bytes.NewReader(compressed[offset:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.flags&blockStored != 0 {
+			t.Fatalf("%s: first block is stored", name)
+		}
+		body := compressed[offset+blockHeaderSize : offset+blockHeaderSize+int64(h.size)]
+		rest := compressed[offset+blockHeaderSize+int64(h.size):]
+
+		// Cut the body short and shrink its header to match, so the
+		// framing is intact and only the symbols run out.
+		for _, size := range []uint32{h.size / 2, h.size - 1} {
+			cut := h
+			cut.size = size
+			var data bytes.Buffer
+			data.Write(compressed[:offset])
+			writeBlockHeader(&data, cut)
+			data.Write(body[:size])
+			data.Write(rest)
+
+			reader, err := NewReader(bytes.NewReader(data.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadAll(reader); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("%s, body of %d bytes: Reader error = %v, expected ErrCorrupt", name, size, err)
+			}
+			readerAt, err := NewReaderAt(bytes.NewReader(data.Bytes()), int64(data.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readerAt.ReadAt(make([]byte, 10), 0); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("%s, body of %d bytes: ReaderAt error = %v, expected ErrCorrupt", name, size, err)
+			}
+		}
+
+		for i := range body {
+			data := bytes.Clone(compressed)
+			data[offset+blockHeaderSize+int64(i)] ^= 0xff
+			reader, err := NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.ReadAll(reader)
+			if err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrHeader) && !errors.Is(err, ErrChecksum) {
+				t.Errorf("%s, byte %d flipped: untyped error %v", name, i, err)
+			}
+		}
+	}
+}
+
+// TestReadHeaderRejectsInvalidCodes checks that prefix tables whose code
+// lengths are out of range, or do not form a complete prefix code, are
+// rejected with ErrHeader.
+func TestReadHeaderRejectsInvalidCodes(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		table []byte
+	}{
+		{"no symbols", []byte{0, 0}},
+		{"too many symbols", []byte{1, 1}},
+		{"symbols out of order", []byte{0, 2, 'b', 1, 'a', 1}},
+		{"code too long", []byte{0, 2, 'a', 1, 'b', maxCodeLengthLimit + 1}},
+		{"incomplete code", []byte{0, 2, 'a', 1, 'b', 2}},
+		{"oversubscribed code", []byte{0, 3, 'a', 1, 'b', 1, 'c', 1}},
+		{"zero length among several", []byte{0, 2, 'a', 0, 'b', 1}},
+		{"truncated", []byte{0, 3, 'a', 1, 'b'}},
+	}
+
+	for _, test := range tests {
+		_, err := newStaticBlock(test.table)
+		if !errors.Is(err, ErrHeader) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, expected ErrHeader", test.name, err)
+		}
+	}
+}
+
+// TestReaderLimits checks that MaxSize and MaxRatio stop a Reader with a
+// *LimitError, and that generous limits let the data through.
+func TestReaderLimits(t *testing.T) {
+
+	input := bytes.Repeat([]byte("a"), 100000)
+
+	// A native Reader stops at the last whole block within MaxSize, and a
+	// gzip one at MaxSize itself.
+	tests := []struct {
+		name    string
+		options WriterOptions
+		read    int64
+	}{
+		{"native", WriterOptions{BlockSize: 10000}, 40000},
+		{"gzip", WriterOptions{Format: FormatGzip}, 45000},
+	}
+
+	for _, test := range tests {
+		compressed := compressBytes(t, input, test.options)
+
+		for _, options := range []ReaderOptions{{MaxSize: 45000}, {MaxRatio: 2}} {
+			reader, err := NewReaderOptions(bytes.NewReader(compressed), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := io.Copy(io.Discard, reader)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Errorf("%s, %+v: got %v, expected a *LimitError", test.name, options, err)
+			}
+			if options.MaxSize > 0 && n != test.read {
+				t.Errorf("%s: read %d bytes with MaxSize %d, expected %d", test.name, n, options.MaxSize, test.read)
+			}
+		}
+
+		reader, err := NewReaderOptions(bytes.NewReader(compressed), ReaderOptions{MaxSize: int64(len(input)), MaxRatio: int64(len(input))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(output, input) {
+			t.Errorf("%s: within the limits got %d bytes, %v", test.name, len(output), err)
+		}
+	}
+}
+
+// TestLimitsBeyondReader checks that ReaderAt, Recover and Inspect stop at
+// the limits as well.
+func TestLimitsBeyondReader(t *testing.T) {
+
+	input := bytes.Repeat([]byte("a"), 100000)
+	compressed := compressBytes(t, input, WriterOptions{BlockSize: 10000})
+	size := int64(len(compressed))
+
+	var limitErr *LimitError
+	for _, options := range []ReaderOptions{{MaxSize: 5000}, {MaxRatio: 2}} {
+		readerAt, err := NewReaderAtOptions(bytes.NewReader(compressed), size, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readerAt.ReadAt(make([]byte, 10), 50000); !errors.As(err, &limitErr) {
+			t.Errorf("ReaderAt, %+v: got %v, expected a *LimitError", options, err)
+		}
+	}
+
+	options := ReaderOptions{MaxSize: 50000}
+	if _, err := Recover(io.Discard, bytes.NewReader(compressed), size, true, options); !errors.As(err, &limitErr) {
+		t.Errorf("Recover: got %v, expected a *LimitError", err)
+	}
+	if _, err := Inspect(bytes.NewReader(compressed), size, options); !errors.As(err, &limitErr) {
+		t.Errorf("Inspect: got %v, expected a *LimitError", err)
+	}
+
+	// Within the limits a ReaderAt still serves every block.
+	readerAt, err := NewReaderAtOptions(bytes.NewReader(compressed), size, ReaderOptions{MaxSize: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := make([]byte, len(input))
+	if _, err := readerAt.ReadAt(output, 0); err != nil || !bytes.Equal(output, input) {
+		t.Errorf("ReaderAt within the limits: %v", err)
+	}
+}
+
+// fuzzSeeds returns small files in every method, coder, alphabet and format.
+func fuzzSeeds(tb testing.TB) [][]byte {
+
+	// Repeated, so that no method falls back to stored blocks.
+	input := bytes.Repeat([]byte("seeds for the fuzzer: a short text, with some repeated words, words, words.\n"), 10)
+
+	var seeds [][]byte
+	for _, options := range []WriterOptions{
+		{},
+		{Method: MethodAdaptive},
+		{Method: MethodContext},
+		{Method: MethodLZ},
+		{Method: MethodLZ, Coder: CoderRange},
+		{Method: MethodBWT},
+		{Method: MethodBWT, Coder: CoderRange},
+		{Coder: CoderRange},
+		{Alphabet: AlphabetRune},
+		{Alphabet: AlphabetWord},
+		{Alphabet: AlphabetExtended},
+		{Index: true},
+		{Format: FormatGzip},
+		{Method: MethodLZ, Format: FormatGzip},
+	} {
+		seeds = append(seeds, compressBytes(tb, input, options))
+	}
+	seeds = append(seeds, compressBytes(tb, []byte("stored"), WriterOptions{}))
+
+	return seeds
+}
+
+// FuzzReadHeader checks that any prefix table either builds a decode table
+// or is rejected with an error, and never panics.
+func FuzzReadHeader(f *testing.F) {
+
+	f.Add([]byte{0, 1, 'a', 0})
+	f.Add([]byte{0, 2, 'a', 1, 'b', 1})
+	f.Add([]byte{0, 3, 'a', 1, 'b', 2, 'c', 2, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		lengths, err := readHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if _, err := newDecodeTable(lengths); err != nil && !errors.Is(err, ErrHeader) {
+			t.Errorf("newDecodeTable: %v is not ErrHeader", err)
+		}
+	})
+}
+
+// FuzzReader checks that the decoder fails cleanly on damaged or crafted
+// input, within limits that keep each case small.
+func FuzzReader(f *testing.F) {
+
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+	f.Add(emptyWordFile(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader, err := NewReaderOptions(bytes.NewReader(data), ReaderOptions{MaxSize: 1 << 20})
+		if err != nil {
+			return
+		}
+		n, _ := io.Copy(io.Discard, reader)
+		if n > 1<<20 {
+			t.Errorf("read %d bytes past MaxSize", n)
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"math/bits"
+)
+
+// DEFLATE (RFC 1951) constants.
+const (
+	deflateWindowSize     = 1 << 15
+	deflateMaxCodeLength  = 15
+	deflateMaxCodeLenBits = 7
+	deflateEndOfBlock     = 256
+	deflateLiteralSymbols = 286
+	deflateDistSymbols    = 30
+	deflateCodeLenSymbols = 19
+)
+
+// deflateLengthBase and deflateLengthExtra describe length codes 257-285.
+var deflateLengthBase = [29]uint16{
+	3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+	35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+}
+
+var deflateLengthExtra = [29]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+	3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+}
+
+// deflateCodeLenOrder is the order code length code lengths are stored in.
+var deflateCodeLenOrder = [deflateCodeLenSymbols]uint8{
+	16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15,
+}
+
+// deflateLengthCode returns the length code index (0-28) for a match length.
+func deflateLengthCode(length int) int {
+	code := 0
+	for code+1 < len(deflateLengthBase) && int(deflateLengthBase[code+1]) <= length {
+		code++
+	}
+	return code
+}
+
+// reverseCode returns the code with its bits in reverse order. DEFLATE packs
+// bits from the least significant end but sends Huffman codes starting with
+// their most significant bit.
+func reverseCode(code bitio.Code) uint64 {
+	return bits.Reverse64(code.Bits) >> (64 - code.Length)
+}
+
+// writeDeflateCode writes code to an LSB-first bw, most significant bit
+// first.
+func writeDeflateCode(bw *bitio.Writer, code bitio.Code) {
+	if code.Length > 0 {
+		bw.WriteBits(reverseCode(code), code.Length)
+	}
+}
+
+// deflateCodeLengths builds length-limited code lengths for a DEFLATE
+// alphabet. DEFLATE has no zero-length codes, so a lone symbol gets a one-bit
+// code, which inflaters accept as a special case.
+func deflateCodeLengths(frequency map[rune]int, maxCodeLength int) map[rune]int {
+	lengths := limitCodeLengths(frequency, maxCodeLength)
+	for symbol, length := range lengths {
+		if length == 0 {
+			lengths[symbol] = 1
+		}
+	}
+	return lengths
+}
+
+// encodeDeflateBlock codes data as one dynamic-Huffman DEFLATE block followed
+// by an empty stored block. The stored block byte-aligns the output, so that
+// blocks encoded independently can simply be concatenated. Back-references
+// are only searched for when matches is set; otherwise every byte is coded
+// as a literal.
+func encodeDeflateBlock(body *bytes.Buffer, data []byte, matches bool) {
+
+	var tokens []lzToken
+	if matches {
+		tokens = findMatches(data, deflateWindowSize)
+	} else {
+		tokens = make([]lzToken, len(data))
+		for i, b := range data {
+			tokens[i].literal = b
+		}
+	}
+
+	literalFrequency := map[rune]int{deflateEndOfBlock: 1}
+	distanceFrequency := make(map[rune]int)
+	for _, token := range tokens {
+		if token.length == 0 {
+			literalFrequency[rune(token.literal)]++
+			continue
+		}
+		literalFrequency[rune(257+deflateLengthCode(int(token.length)))]++
+		distanceCode, _, _ := bucket(token.distance - 1)
+		distanceFrequency[rune(distanceCode)]++
+	}
+	if len(distanceFrequency) == 0 {
+		distanceFrequency[0] = 1
+	}
+
+	literalLengths := deflateCodeLengths(literalFrequency, deflateMaxCodeLength)
+	distanceLengths := deflateCodeLengths(distanceFrequency, deflateMaxCodeLength)
+
+	numLiterals := 257
+	for symbol := range literalLengths {
+		numLiterals = max(numLiterals, int(symbol)+1)
+	}
+	numDistances := 1
+	for symbol := range distanceLengths {
+		numDistances = max(numDistances, int(symbol)+1)
+	}
+
+	bw := bitio.NewLSBWriter(body)
+
+	bw.WriteBits(0, 1) // BFINAL
+	bw.WriteBits(2, 2) // BTYPE: dynamic Huffman codes
+	bw.WriteBits(uint64(numLiterals-257), 5)
+	bw.WriteBits(uint64(numDistances-1), 5)
+
+	combined := make([]int, 0, numLiterals+numDistances)
+	for symbol := 0; symbol < numLiterals; symbol++ {
+		combined = append(combined, literalLengths[rune(symbol)])
+	}
+	for symbol := 0; symbol < numDistances; symbol++ {
+		combined = append(combined, distanceLengths[rune(symbol)])
+	}
+	writeDeflateCodeLengths(bw, combined)
+
+	literalCodes := codeTable(literalLengths, deflateLiteralSymbols)
+	distanceCodes := codeTable(distanceLengths, deflateDistSymbols)
+
+	for _, token := range tokens {
+		if token.length == 0 {
+			writeDeflateCode(bw, literalCodes[token.literal])
+			continue
+		}
+
+		lengthCode := deflateLengthCode(int(token.length))
+		writeDeflateCode(bw, literalCodes[257+lengthCode])
+		bw.WriteBits(uint64(int(token.length)-int(deflateLengthBase[lengthCode])), uint(deflateLengthExtra[lengthCode]))
+
+		distanceCode, extraBits, extra := bucket(token.distance - 1)
+		writeDeflateCode(bw, distanceCodes[distanceCode])
+		bw.WriteBits(uint64(extra), extraBits)
+	}
+	writeDeflateCode(bw, literalCodes[deflateEndOfBlock])
+
+	// Empty stored block: BFINAL 0, BTYPE 00, padding, LEN 0 and NLEN 0xffff.
+	bw.WriteBits(0, 3)
+	bw.Flush()
+	body.Write([]byte{0x00, 0x00, 0xff, 0xff})
+}
+
+// maxStoredDeflateLength is the most data one stored DEFLATE block holds.
+const maxStoredDeflateLength = 0xffff
+
+// storedDeflateSize returns the length of data written as stored blocks by
+// encodeStoredDeflateBlocks.
+func storedDeflateSize(length int) int {
+	return length + 5*((length+maxStoredDeflateLength-1)/maxStoredDeflateLength)
+}
+
+// encodeStoredDeflateBlocks writes data as stored DEFLATE blocks, each a
+// header byte with BFINAL 0 and BTYPE 00, LEN, NLEN and the data. Like the
+// output of encodeDeflateBlock they end on a byte boundary.
+func encodeStoredDeflateBlocks(body *bytes.Buffer, data []byte) {
+	for len(data) > 0 {
+		n := min(len(data), maxStoredDeflateLength)
+		body.Write([]byte{0x00, byte(n), byte(n >> 8), ^byte(n), ^byte(n >> 8)})
+		body.Write(data[:n])
+		data = data[n:]
+	}
+}
+
+// codeLengthToken is one symbol of the code length alphabet: a length, or a
+// repeat instruction with its extra bits.
+type codeLengthToken struct {
+	symbol    int
+	extra     uint64
+	extraBits uint
+}
+
+// writeDeflateCodeLengths run-length encodes the literal/length and distance
+// code lengths with the code length alphabet, and writes that alphabet's own
+// code lengths first.
+func writeDeflateCodeLengths(bw *bitio.Writer, lengths []int) {
+
+	var tokens []codeLengthToken
+	for i := 0; i < len(lengths); {
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == lengths[i] {
+			run++
+		}
+
+		switch {
+		case lengths[i] == 0 && run >= 11:
+			run = min(run, 138)
+			tokens = append(tokens, codeLengthToken{18, uint64(run - 11), 7})
+		case lengths[i] == 0 && run >= 3:
+			run = min(run, 10)
+			tokens = append(tokens, codeLengthToken{17, uint64(run - 3), 3})
+		case lengths[i] != 0 && run >= 4:
+			run = min(run, 7)
+			tokens = append(tokens, codeLengthToken{lengths[i], 0, 0}, codeLengthToken{16, uint64(run - 4), 2})
+		default:
+			run = 1
+			tokens = append(tokens, codeLengthToken{lengths[i], 0, 0})
+		}
+		i += run
+	}
+
+	frequency := make(map[rune]int)
+	for _, token := range tokens {
+		frequency[rune(token.symbol)]++
+	}
+	codeLengthLengths := deflateCodeLengths(frequency, deflateMaxCodeLenBits)
+
+	numCodeLengths := 4
+	for i, symbol := range deflateCodeLenOrder {
+		if codeLengthLengths[rune(symbol)] > 0 {
+			numCodeLengths = max(numCodeLengths, i+1)
+		}
+	}
+
+	bw.WriteBits(uint64(numCodeLengths-4), 4)
+	for _, symbol := range deflateCodeLenOrder[:numCodeLengths] {
+		bw.WriteBits(uint64(codeLengthLengths[rune(symbol)]), 3)
+	}
+
+	codes := codeTable(codeLengthLengths, deflateCodeLenSymbols)
+	for _, token := range tokens {
+		writeDeflateCode(bw, codes[token.symbol])
+		bw.WriteBits(token.extra, token.extraBits)
+	}
+}
@@ -1,167 +1,561 @@
 package huffman
 
 import (
-	"encoding/binary"
+	"bufio"
+	"bytes"
+	"compressor/bitio"
+	"errors"
 	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 )
 
-func Encode(filename string, outputFilename string) error {
+// ErrClosed is returned when writing to a Writer that has already been closed.
+var ErrClosed = errors.New("huffman: write to closed writer")
 
-	frequency, err := createFrequencyMap(filename)
+// DefaultBlockSize is the number of input bytes coded with one table unless
+// told otherwise.
+const DefaultBlockSize = 1 << 20
+
+// WriterOptions configures a Writer. The zero value selects the defaults.
+type WriterOptions struct {
+	// MaxCodeLength caps the length of every Huffman code, in bits. Zero
+	// means DefaultMaxCodeLength.
+	MaxCodeLength int
+
+	// BlockSize is the number of input bytes that share one code table.
+	// Zero means DefaultBlockSize.
+	BlockSize int
+
+	// Concurrency is the number of blocks encoded in parallel. Zero means
+	// runtime.GOMAXPROCS(0). The output does not depend on it.
+	Concurrency int
+
+	// Index appends a block index to the stream, so that a ReaderAt can
+	// find any offset without scanning the blocks.
+	Index bool
+
+	// Method selects how blocks are coded. The zero value is MethodHuffman.
+	Method Method
+
+	// Coder selects the entropy coder for the symbols of every block. The
+	// zero value is CoderHuffman. MethodAdaptive and MethodContext only
+	// support CoderHuffman.
+	Coder Coder
+
+	// Alphabet selects what MethodHuffman counts as a symbol. The zero value
+	// is AlphabetByte, the only alphabet of the other methods and coders.
+	Alphabet Alphabet
+
+	// WindowSize is how far back MethodLZ looks for matches, in bytes. It
+	// must be a power of two. Zero means DefaultWindowSize.
+	WindowSize int
+
+	// Format selects the container. With FormatGzip every block is coded as
+	// DEFLATE: MethodHuffman codes literals only and MethodLZ adds
+	// back-references. Other methods and Index are not supported.
+	Format Format
+}
+
+// Encode compresses filename into outputFilename, recording the base name,
+// permissions and modification time of filename in the header. If encoding
+// fails, the partial output is removed.
+func Encode(filename string, outputFilename string, options WriterOptions) error {
+
+	writer, err := NewWriterOptions(nil, options)
 	if err != nil {
 		return err
 	}
 
-	prefixTable := buildPrefixTable(frequency)
+	inputFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
 
-	compressedData, err := compressData(filename, prefixTable)
+	info, err := inputFile.Stat()
 	if err != nil {
 		return err
 	}
 
-	if err := outputToFile(outputFilename, prefixTable, compressedData); err != nil {
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
 		return err
 	}
+	defer outputFile.Close()
 
-	return nil
-}
+	discard := func(err error) error {
+		outputFile.Close()
+		os.Remove(outputFilename)
+		return err
+	}
 
-func createFrequencyMap(filename string) (map[rune]int, error) {
-	fileContent, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading file")
+	writer.Reset(outputFile)
+	writer.Header = Header{Name: filepath.Base(filename), Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+
+	if _, err := io.Copy(writer, inputFile); err != nil {
+		return discard(err)
 	}
 
-	frequency := make(map[rune]int)
+	if err := writer.Close(); err != nil {
+		return discard(err)
+	}
 
-	for _, character := range fileContent {
-		frequency[rune(character)]++
+	if err := outputFile.Close(); err != nil {
+		return discard(err)
 	}
 
-	return frequency, nil
+	return nil
 }
 
-func buildPrefixTable(frequency map[rune]int) map[rune]string {
+// A Writer is an io.WriteCloser that Huffman-compresses everything written to
+// it. Input is split into blocks of BlockSize bytes, each with its own code
+// table. Full blocks are handed to a pool of encoding goroutines and written
+// out in order as they complete; Close flushes the last partial block.
+//
+// A block that coding would not shrink is stored as it is, so output exceeds
+// the input by no more than the framing. In FormatNative that is 31 bytes per
+// block and 31 bytes per file, plus the Header and any index. In FormatGzip
+// it is 5 bytes for every 65,535 stored bytes and 20 bytes per file, plus the
+// name and its terminating zero byte.
+type Writer struct {
+	// Header is recorded in the file header when any of its fields is set.
+	// It must be filled in before the first Write or Close.
+	Header
+
+	w       *bufio.Writer
+	options WriterOptions
+
+	block  []byte
+	size   uint64
+	digest hash.Hash32
+
+	jobs    chan blockJob
+	pending []blockJob
+
+	// offset is the number of bytes written so far, and index records where
+	// each block starts. written is the original length of the blocks
+	// written so far.
+	offset  int64
+	index   []indexEntry
+	written uint64
+
+	wroteHeader bool
+	closed      bool
+	err         error
+}
 
-	huffmanTree := buildTree(frequency)
+// blockJob is one block travelling through the worker pool. The worker
+// sends exactly one result on done.
+type blockJob struct {
+	data []byte
+	done chan blockResult
+}
 
-	prefixTable := constructTable(huffmanTree)
+type blockResult struct {
+	length   int
+	checksum uint32
+	encoded  []byte
+	stored   bool
+	err      error
+}
 
-	return prefixTable
+// NewWriter returns a new Writer with the default options. Writes to the
+// returned writer are compressed and written to w.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterOptions(w, WriterOptions{})
+	return z
 }
 
-func compressData(filename string, prefixTable map[rune]string) ([]byte, error) {
+// NewWriterOptions is like NewWriter but uses the given options instead of
+// the defaults. The error is non-nil only if an option is out of range.
+func NewWriterOptions(w io.Writer, options WriterOptions) (*Writer, error) {
 
-	fileContent, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("error reading file")
+	if options.MaxCodeLength == 0 {
+		options.MaxCodeLength = DefaultMaxCodeLength
+	}
+	if options.MaxCodeLength < 1 || options.MaxCodeLength > maxCodeLengthLimit {
+		return nil, fmt.Errorf("huffman: invalid max code length %d, must be between 1 and %d", options.MaxCodeLength, maxCodeLengthLimit)
 	}
 
-	var compressedData []byte
-	var currentByte byte
+	if options.BlockSize == 0 {
+		options.BlockSize = DefaultBlockSize
+	}
+	if options.BlockSize < 1 || options.BlockSize > maxBlockSize {
+		return nil, fmt.Errorf("huffman: invalid block size %d, must be between 1 and %d", options.BlockSize, maxBlockSize)
+	}
 
-	bitIndex := 0
+	if options.Concurrency == 0 {
+		options.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if options.Concurrency < 1 {
+		return nil, fmt.Errorf("huffman: invalid concurrency %d", options.Concurrency)
+	}
 
-	for _, character := range fileContent {
-		code, exists := prefixTable[rune(character)]
-		if !exists {
-			return nil, fmt.Errorf("huffman code not found for character %c", rune(character))
-		}
+	if !options.Method.valid() {
+		return nil, fmt.Errorf("huffman: unknown method %v", options.Method)
+	}
 
-		for _, codeBit := range code {
+	if !options.Coder.valid() {
+		return nil, fmt.Errorf("huffman: unknown coder %v", options.Coder)
+	}
+	if options.Coder != CoderHuffman && !options.Method.supportsCoders() {
+		return nil, fmt.Errorf("huffman: the %v coder cannot be combined with the %v method", options.Coder, options.Method)
+	}
+	if options.Coder != CoderHuffman && options.Format == FormatGzip {
+		return nil, fmt.Errorf("huffman: the %v coder cannot be combined with the %v format", options.Coder, options.Format)
+	}
 
-			if codeBit == '1' {
-				currentByte |= (1 << (7 - bitIndex))
-			}
-			bitIndex++
+	if !options.Alphabet.valid() {
+		return nil, fmt.Errorf("huffman: unknown alphabet %v", options.Alphabet)
+	}
+	if options.Alphabet != AlphabetByte && (options.Method != MethodHuffman || options.Coder != CoderHuffman || options.Format == FormatGzip) {
+		return nil, fmt.Errorf("huffman: the %v alphabet needs the huffman method and coder and the native format", options.Alphabet)
+	}
 
-			if bitIndex == 8 {
-				compressedData = append(compressedData, currentByte)
-				currentByte = 0
-				bitIndex = 0
-			}
+	if options.WindowSize == 0 {
+		options.WindowSize = DefaultWindowSize
+	}
+	if !options.Format.valid() {
+		return nil, fmt.Errorf("huffman: unknown format %v", options.Format)
+	}
+	if options.Format == FormatGzip && (options.Index || (options.Method != MethodHuffman && options.Method != MethodLZ)) {
+		return nil, fmt.Errorf("huffman: the gzip format cannot be combined with an index or the %v method", options.Method)
+	}
 
-		}
+	if options.WindowSize < minWindowSize || options.WindowSize > maxWindowSize || options.WindowSize&(options.WindowSize-1) != 0 {
+		return nil, fmt.Errorf("huffman: invalid window size %d, must be a power of two between %d and %d", options.WindowSize, minWindowSize, maxWindowSize)
+	}
 
+	z := &Writer{options: options}
+	z.Reset(w)
+
+	return z, nil
+}
+
+// Reset discards the Writer's state and makes it equivalent to the result of
+// NewWriterOptions with its original options, writing to w instead.
+func (z *Writer) Reset(w io.Writer) {
+	z.stopWorkers()
+	*z = Writer{
+		w:       bufio.NewWriter(w),
+		options: z.options,
+		digest:  crc32.NewIEEE(),
+	}
+}
+
+// Write buffers p and encodes every block it completes.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrClosed
+	}
+	if z.err != nil {
+		return 0, z.err
 	}
 
-	if bitIndex > 0 {
-		compressedData = append(compressedData, currentByte)
+	z.digest.Write(p)
+	z.size += uint64(len(p))
+
+	written := 0
+	for len(p) > 0 {
+		if z.block == nil {
+			z.block = make([]byte, 0, z.options.BlockSize)
+		}
+
+		n := min(len(p), z.options.BlockSize-len(z.block))
+		z.block = append(z.block, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(z.block) == z.options.BlockSize {
+			if z.err = z.submitBlock(); z.err != nil {
+				return written, z.err
+			}
+		}
 	}
 
-	return compressedData, nil
+	return written, nil
 }
 
-func outputToFile(outputFilename string, prefixTable map[rune]string, compressedData []byte) error {
+// Close encodes the last partial block, waits for every pending block and
+// writes the trailer. It does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.err
+	}
+	z.closed = true
 
-	outputFile, err := os.Create(outputFilename)
-	if err != nil {
+	if z.err == nil && len(z.block) > 0 {
+		z.err = z.submitBlock()
+	}
+	for z.err == nil && len(z.pending) > 0 {
+		z.err = z.writeOldestBlock()
+	}
+	z.stopWorkers()
+	if z.err != nil {
+		return z.err
+	}
+
+	if err := z.writeFileHeader(); err != nil {
 		return err
 	}
 
-	if err := writeHeader(outputFile, prefixTable); err != nil {
+	if z.options.Format == FormatGzip {
+		if _, err := z.w.Write(gzipFinalBlock); err != nil {
+			return err
+		}
+		if err := writeGzipTrailer(z.w, z.digest.Sum32(), z.size); err != nil {
+			return err
+		}
+		return z.w.Flush()
+	}
+
+	if err := writeBlockHeader(z.w, blockHeader{}); err != nil {
 		return err
 	}
 
-	if err := binary.Write(outputFile, binary.BigEndian, compressedData); err != nil {
+	if err := writeTrailer(z.w, trailer{size: z.size, checksum: z.digest.Sum32()}); err != nil {
 		return err
 	}
+	z.offset += endMarkerSize + 12
+
+	if z.options.Index {
+		if err := writeIndex(z.w, z.offset, z.index); err != nil {
+			return err
+		}
+	}
+
+	return z.w.Flush()
+}
+
+// submitBlock hands the current block to the worker pool. At most
+// Concurrency blocks are in flight; beyond that the oldest one is written out
+// first, which keeps the output in input order.
+func (z *Writer) submitBlock() error {
+
+	if z.jobs == nil {
+		z.jobs = make(chan blockJob)
+		for i := 0; i < z.options.Concurrency; i++ {
+			go encodeWorker(z.jobs, z.options)
+		}
+	}
+
+	if len(z.pending) == z.options.Concurrency {
+		if err := z.writeOldestBlock(); err != nil {
+			return err
+		}
+	}
+
+	job := blockJob{data: z.block, done: make(chan blockResult, 1)}
+	z.jobs <- job
+	z.pending = append(z.pending, job)
+	z.block = nil
 
 	return nil
 }
 
-func writeHeader(outputFile *os.File, prefixTable map[rune]string) error {
+// writeOldestBlock waits for the first pending block and writes it.
+func (z *Writer) writeOldestBlock() error {
 
-	numCharacters := uint32(len(prefixTable))
-	if err := binary.Write(outputFile, binary.BigEndian, numCharacters); err != nil {
+	result := <-z.pending[0].done
+	z.pending = z.pending[1:]
+	if result.err != nil {
+		return result.err
+	}
+
+	if err := z.writeFileHeader(); err != nil {
 		return err
 	}
 
-	for character, code := range prefixTable {
+	if z.options.Index {
+		z.index = append(z.index, indexEntry{offset: z.offset, length: result.length})
+	}
 
-		if err := binary.Write(outputFile, binary.BigEndian, uint8(character)); err != nil {
-			return err
+	if z.options.Format == FormatNative {
+		h := blockHeader{length: uint32(result.length), start: z.written, size: uint32(len(result.encoded)), checksum: result.checksum}
+		if result.stored {
+			h.flags |= blockStored
 		}
-
-		codeLength := uint8(len(code))
-		if err := binary.Write(outputFile, binary.BigEndian, codeLength); err != nil {
+		if err := writeBlockHeader(z.w, h); err != nil {
 			return err
 		}
+		z.offset += blockHeaderSize
+	}
+	z.offset += int64(len(result.encoded))
+	z.written += uint64(result.length)
 
-		var currentByte byte
+	_, err := z.w.Write(result.encoded)
+	return err
+}
 
-		bitIndex := 0
+func (z *Writer) writeFileHeader() error {
+	if z.wroteHeader {
+		return nil
+	}
+	z.wroteHeader = true
 
-		for _, codeBit := range code {
+	if z.options.Format == FormatGzip {
+		return writeGzipHeader(z.w, z.Header)
+	}
 
-			if codeBit == '1' {
-				currentByte |= (1 << (7 - bitIndex))
-			}
-			bitIndex++
-
-			if bitIndex == 8 {
-				if err := binary.Write(outputFile, binary.BigEndian, currentByte); err != nil {
-					return err
-				}
-				currentByte = 0
-				bitIndex = 0
-			}
+	header := fileHeader{version: formatVersion, method: z.options.Method, coder: z.options.Coder, alphabet: z.options.Alphabet}
+	if z.options.Index {
+		header.flags |= flagIndex
+	}
+	if !z.Header.empty() {
+		header.flags |= flagMetadata
+		header.metadata = z.Header
+	}
+	z.offset += header.size()
+
+	return writeFileHeader(z.w, header)
+}
+
+// stopWorkers shuts the worker pool down. Blocks still in flight finish on
+// their own, since every result channel is buffered.
+func (z *Writer) stopWorkers() {
+	if z.jobs != nil {
+		close(z.jobs)
+		z.jobs = nil
+	}
+}
+
+func encodeWorker(jobs <-chan blockJob, options WriterOptions) {
+	for job := range jobs {
+		encoded, stored, err := encodeBlock(job.data, options)
+		job.done <- blockResult{length: len(job.data), checksum: crc32.ChecksumIEEE(job.data), encoded: encoded, stored: stored, err: err}
+	}
+}
+
+// encodeBlock codes one block with the configured method, returning its
+// body. Data that coding would not make smaller is returned as it is, to be
+// written as a stored block. In the gzip format a block is a self-contained
+// run of DEFLATE blocks instead, stored ones in the same case.
+func encodeBlock(data []byte, options WriterOptions) ([]byte, bool, error) {
 
+	var body bytes.Buffer
+
+	if options.Format == FormatGzip {
+		encodeDeflateBlock(&body, data, options.Method == MethodLZ)
+		if body.Len() > storedDeflateSize(len(data)) {
+			body.Reset()
+			encodeStoredDeflateBlocks(&body, data)
 		}
+		return body.Bytes(), false, nil
+	}
 
-		if bitIndex > 0 {
-			if err := binary.Write(outputFile, binary.BigEndian, currentByte); err != nil {
-				return err
-			}
+	switch {
+	case options.Method == MethodAdaptive:
+		encodeAdaptiveBlock(&body, data)
+	case options.Method == MethodContext:
+		if err := encodeContextBlock(&body, data, options.MaxCodeLength); err != nil {
+			return nil, false, err
+		}
+	case options.Method == MethodBWT:
+		if err := encodeBWTBlock(&body, data, options.Coder, options.MaxCodeLength); err != nil {
+			return nil, false, err
+		}
+	case options.Method == MethodLZ:
+		if err := encodeLZBlock(&body, data, options.WindowSize, options.Coder, options.MaxCodeLength); err != nil {
+			return nil, false, err
+		}
+	case options.Alphabet != AlphabetByte:
+		if err := encodeWideBlock(&body, data, options.Alphabet, options.MaxCodeLength); err != nil {
+			return nil, false, err
+		}
+	case options.Coder != CoderHuffman:
+		if err := encodeSymbolBlock(&body, data, options.Coder, options.MaxCodeLength); err != nil {
+			return nil, false, err
 		}
+	default:
+		if err := encodeStaticBlock(&body, data, options.MaxCodeLength); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if body.Len() >= len(data) {
+		return data, true, nil
+	}
+
+	return body.Bytes(), false, nil
+}
+
+// encodeStaticBlock codes data with a table built from its own statistics,
+// storing the code lengths in front of the codes.
+func encodeStaticBlock(body *bytes.Buffer, data []byte, maxCodeLength int) error {
+
+	frequency := createFrequencyMap(data)
 
+	if len(frequency) > 1<<maxCodeLength {
+		return fmt.Errorf("huffman: %d symbols cannot be coded in %d bits", len(frequency), maxCodeLength)
 	}
 
-	endMarker := uint16(0xFFFF)
-	if err := binary.Write(outputFile, binary.BigEndian, endMarker); err != nil {
+	prefixTable := buildPrefixTable(frequency, maxCodeLength)
+
+	if err := writeHeader(body, prefixTable); err != nil {
 		return err
 	}
 
-	return nil
+	return compressData(body, data, prefixTable)
+}
+
+func createFrequencyMap(data []byte) map[rune]int {
+
+	frequency := make(map[rune]int)
+
+	for _, character := range data {
+		frequency[rune(character)]++
+	}
+
+	return frequency
+}
+
+func buildPrefixTable(frequency map[rune]int, maxCodeLength int) map[rune]bitio.Code {
+
+	prefixTable := canonicalCodes(limitCodeLengths(frequency, maxCodeLength))
+
+	return prefixTable
+}
+
+func compressData(output io.Writer, data []byte, prefixTable map[rune]bitio.Code) error {
+
+	var codes [256]bitio.Code
+	var exists [256]bool
+	for character, code := range prefixTable {
+		codes[character] = code
+		exists[character] = true
+	}
+
+	bw := bitio.NewWriter(output)
+
+	for _, character := range data {
+		if !exists[character] {
+			return fmt.Errorf("huffman code not found for character %c", rune(character))
+		}
+		bw.WriteCode(codes[character])
+	}
+
+	return bw.Flush()
+}
+
+// writeHeader stores one code length per symbol, in symbol order. The codes
+// themselves are canonical, so they are not written out.
+func writeHeader(outputFile io.Writer, prefixTable map[rune]bitio.Code) error {
+
+	bw := bitio.NewWriter(outputFile)
+
+	bw.WriteBits(uint64(len(prefixTable)), 16)
+
+	for _, character := range sortedSymbols(prefixTable) {
+		bw.WriteBits(uint64(character), 8)
+		bw.WriteBits(uint64(prefixTable[character].Length), 8)
+	}
+
+	return bw.Flush()
 }
@@ -1,6 +1,12 @@
 package huffman
 
 import (
+	"bytes"
+	"compressor/bitio"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -17,17 +23,17 @@ func TestBuildPrefixTable(t *testing.T) {
 		'f': 45,
 	}
 
-	// Expected prefix table (codes may vary, as Huffman trees can have multiple valid structures)
-	expected := map[rune]string{
-		'a': "1100",
-		'b': "1101",
-		'c': "100",
-		'd': "101",
-		'e': "111",
-		'f': "0",
+	// Expected canonical prefix table: codes are assigned in order of length, then symbol
+	expected := map[rune]bitio.Code{
+		'a': {Bits: 0b1110, Length: 4},
+		'b': {Bits: 0b1111, Length: 4},
+		'c': {Bits: 0b100, Length: 3},
+		'd': {Bits: 0b101, Length: 3},
+		'e': {Bits: 0b110, Length: 3},
+		'f': {Bits: 0b0, Length: 1},
 	}
 
-	prefixTable := buildPrefixTable(frequency)
+	prefixTable := buildPrefixTable(frequency, DefaultMaxCodeLength)
 
 	// Verify the prefix table generated
 	if !reflect.DeepEqual(prefixTable, expected) {
@@ -40,7 +46,7 @@ func TestBuildPrefixTableEmpty(t *testing.T) {
 	frequency := map[rune]int{}
 
 	// Call the function
-	prefixTable := buildPrefixTable(frequency)
+	prefixTable := buildPrefixTable(frequency, DefaultMaxCodeLength)
 
 	// Verify the result is an empty map
 	if len(prefixTable) != 0 {
@@ -54,15 +60,210 @@ func TestBuildPrefixTableSingleElement(t *testing.T) {
 		'a': 1,
 	}
 
-	// Expected prefix table (only one character, so it should get an empty code or "0")
-	expected := map[rune]string{
-		'a': "",
+	// Expected prefix table (only one character, so it should get an empty code)
+	expected := map[rune]bitio.Code{
+		'a': {},
 	}
 
-	prefixTable := buildPrefixTable(frequency)
+	prefixTable := buildPrefixTable(frequency, DefaultMaxCodeLength)
 
 	// Verify the prefix table generated
 	if !reflect.DeepEqual(prefixTable, expected) {
 		t.Errorf("Prefix table does not match expected output.\nGot: %v\nExpected: %v", prefixTable, expected)
 	}
 }
+
+// TestEncodeDeterministic checks that compressing the same input twice gives
+// byte-identical output, even with many symbols of equal frequency.
+func TestEncodeDeterministic(t *testing.T) {
+	input := []byte("abcdefghijklmnopqrstuvwxyz ABCDEFGHIJKLMNOPQRSTUVWXYZ 0123456789")
+
+	compress := func() []byte {
+		var compressed bytes.Buffer
+		writer := NewWriter(&compressed)
+		if _, err := writer.Write(input); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return compressed.Bytes()
+	}
+
+	expected := compress()
+	for i := 0; i < 20; i++ {
+		if got := compress(); !bytes.Equal(got, expected) {
+			t.Fatalf("run %d produced different output.\nGot: %x\nExpected: %x", i, got, expected)
+		}
+	}
+}
+
+// TestEncodeRemovesOutput checks that Encode leaves no output behind when
+// the input cannot be read or cannot be coded.
+func TestEncodeRemovesOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	if err := os.WriteFile(input, []byte("more than sixteen different bytes: 0123456789abcdef"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filename string
+		options  WriterOptions
+	}{
+		{dir, WriterOptions{}},
+		{input, WriterOptions{MaxCodeLength: 4}},
+	}
+
+	for _, test := range tests {
+		output := filepath.Join(dir, "output")
+		if err := Encode(test.filename, output, test.options); err == nil {
+			t.Errorf("Encode(%q, %+v) succeeded, expected an error", test.filename, test.options)
+		}
+		if _, err := os.Stat(output); !os.IsNotExist(err) {
+			t.Errorf("Encode(%q, %+v) left output behind: %v", test.filename, test.options, err)
+		}
+	}
+}
+
+// TestLimitCodeLengths feeds Fibonacci frequencies, which make the plain
+// Huffman tree as deep as possible, and checks that every limit is honoured
+// while the lengths still form a complete prefix code.
+func TestLimitCodeLengths(t *testing.T) {
+	frequency := make(map[rune]int)
+	a, b := 1, 1
+	for char := rune(0); char < 30; char++ {
+		frequency[char] = a
+		a, b = b, a+b
+	}
+
+	for _, maxCodeLength := range []int{5, 8, 15} {
+		lengths := limitCodeLengths(frequency, maxCodeLength)
+
+		kraft := 0.0
+		for char, length := range lengths {
+			if length < 1 || length > maxCodeLength {
+				t.Errorf("limit %d: symbol %d has code length %d", maxCodeLength, char, length)
+			}
+			kraft += 1 / float64(int(1)<<length)
+		}
+		if kraft != 1 {
+			t.Errorf("limit %d: Kraft sum is %v, expected 1", maxCodeLength, kraft)
+		}
+	}
+}
+
+// TestWriterMaxCodeLength round-trips skewed data with a tight code length
+// limit and rejects limits that cannot be honoured.
+func TestWriterMaxCodeLength(t *testing.T) {
+	var input []byte
+	count := 1
+	for char := byte('a'); char <= 'z'; char++ {
+		input = append(input, bytes.Repeat([]byte{char}, count)...)
+		count = count*3/2 + 1
+	}
+
+	var compressed bytes.Buffer
+	writer, err := NewWriterOptions(&compressed, WriterOptions{MaxCodeLength: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Errorf("round trip mismatch: got %d bytes, expected %d", len(output), len(input))
+	}
+
+	if _, err := NewWriterOptions(io.Discard, WriterOptions{MaxCodeLength: maxCodeLengthLimit + 1}); err == nil {
+		t.Errorf("expected an error for max code length %d", maxCodeLengthLimit+1)
+	}
+
+	writer, _ = NewWriterOptions(io.Discard, WriterOptions{MaxCodeLength: 4})
+	writer.Write(input)
+	if err := writer.Close(); err == nil {
+		t.Errorf("expected an error coding %d symbols in 4 bits", 26)
+	}
+}
+
+// TestStoredBlocks checks that random data, which no method shrinks, is
+// written as stored blocks that cost no more than the framing the Writer
+// documents, and that those blocks decode back to the input.
+func TestStoredBlocks(t *testing.T) {
+	input := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(input)
+
+	// The file header, a header per block, the end marker and the trailer.
+	overhead := fileHeaderSize + 10*blockHeaderSize + endMarkerSize + 12
+	if n := len(compressBytes(t, []byte("a"), WriterOptions{})); n != 63 {
+		t.Errorf("1 byte compressed to %d bytes, expected 63", n)
+	}
+
+	for _, options := range []WriterOptions{
+		{BlockSize: 10000},
+		{BlockSize: 10000, Method: MethodLZ, Coder: CoderRange},
+		{BlockSize: 10000, Method: MethodBWT},
+		{BlockSize: 10000, Alphabet: AlphabetWord},
+		{BlockSize: 10000, Format: FormatGzip},
+	} {
+		compressed := compressBytes(t, input, options)
+		limit := len(input) + overhead
+		if options.Format == FormatGzip {
+			// A gzip header and trailer, and five bytes per stored block.
+			limit = len(input) + 18 + 5*(len(input)/maxStoredDeflateLength+10) + len(gzipFinalBlock)
+		}
+		if len(compressed) > limit {
+			t.Errorf("%+v: %d bytes compressed to %d, expected at most %d", options, len(input), len(compressed), limit)
+		}
+
+		reader, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(reader)
+		if err != nil || !bytes.Equal(output, input) {
+			t.Errorf("%+v: round trip got %d bytes, %v", options, len(output), err)
+		}
+
+		if options.Format == FormatNative {
+			info, err := Inspect(bytes.NewReader(compressed), int64(len(compressed)), ReaderOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, block := range info.Blocks {
+				if !block.Stored || len(block.Symbols) != 0 {
+					t.Errorf("%+v: block %d = %+v, expected a stored block", options, i, block)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkEncodeStaticBlock measures building and writing the prefix code
+// of a block, and packing its codes.
+func BenchmarkEncodeStaticBlock(b *testing.B) {
+	input := benchmarkInput()
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var body bytes.Buffer
+		if err := encodeStaticBlock(&body, input, DefaultMaxCodeLength); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
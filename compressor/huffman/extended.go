@@ -0,0 +1,115 @@
+package huffman
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// minExtendedCount is how often a byte pair or triple must be used in a
+	// block to be worth listing as an extended symbol.
+	minExtendedCount = 8
+
+	// maxExtendedSymbols bounds the number of extended symbols in a block.
+	maxExtendedSymbols = 4096
+)
+
+// extendedSymbols splits data into AlphabetExtended symbols: single bytes,
+// and the frequent byte pairs and triples it lists as extended symbols.
+//
+// Candidates are chosen greedily by the bits they would save, counted over
+// every position and priced with the byte statistics of createFrequencyMap,
+// and data is then parsed greedily, preferring a listed triple over a listed
+// pair over a single byte. The parse uses some candidates less than counted,
+// so the ones that fall below minExtendedCount are dropped and data is parsed
+// again.
+func extendedSymbols(data []byte, maxSymbols int) ([]rune, []string) {
+
+	counts := make(map[string]int)
+	for i := 0; i+1 < len(data); i++ {
+		counts[string(data[i:i+2])]++
+		if i+2 < len(data) {
+			counts[string(data[i:i+3])]++
+		}
+	}
+
+	// A sequence saves the bits its bytes cost on their own, estimated from
+	// the byte frequencies, less the bits of its own symbol.
+	frequency := createFrequencyMap(data)
+	bits := func(count int) float64 {
+		return math.Log2(float64(len(data)) / float64(count))
+	}
+
+	var sequences []string
+	saving := make(map[string]float64)
+	for sequence, count := range counts {
+		if count < minExtendedCount {
+			continue
+		}
+		saved := -bits(count)
+		for i := 0; i < len(sequence); i++ {
+			saved += bits(frequency[rune(sequence[i])])
+		}
+		sequences = append(sequences, sequence)
+		saving[sequence] = float64(count) * saved
+	}
+	sort.Slice(sequences, func(i, j int) bool {
+		if saving[sequences[i]] != saving[sequences[j]] {
+			return saving[sequences[i]] > saving[sequences[j]]
+		}
+		return sequences[i] < sequences[j]
+	})
+	sequences = sequences[:min(len(sequences), maxExtendedSymbols, max(0, maxSymbols-firstWordSymbol))]
+
+	symbols := parseExtended(data, sequences)
+
+	used := make([]int, len(sequences))
+	for _, symbol := range symbols {
+		if symbol >= firstWordSymbol {
+			used[symbol-firstWordSymbol]++
+		}
+	}
+	kept := sequences[:0]
+	for i, sequence := range sequences {
+		if used[i] >= minExtendedCount {
+			kept = append(kept, sequence)
+		}
+	}
+	if len(kept) < len(sequences) {
+		symbols = parseExtended(data, kept)
+	}
+
+	return symbols, kept
+}
+
+// parseExtended splits data into single bytes and the given sequences,
+// longest first, numbering the sequences from firstWordSymbol.
+func parseExtended(data []byte, sequences []string) []rune {
+
+	ids := make(map[string]rune, len(sequences))
+	for i, sequence := range sequences {
+		ids[sequence] = firstWordSymbol + rune(i)
+	}
+
+	symbols := make([]rune, 0, len(data))
+	for i := 0; i < len(data); {
+		if i+3 <= len(data) {
+			if id, ok := ids[string(data[i:i+3])]; ok {
+				symbols = append(symbols, id)
+				i += 3
+				continue
+			}
+		}
+		if i+2 <= len(data) {
+			if id, ok := ids[string(data[i:i+2])]; ok {
+				symbols = append(symbols, id)
+				i += 2
+				continue
+			}
+		}
+		symbols = append(symbols, rune(data[i]))
+		i++
+	}
+
+	return symbols
+}
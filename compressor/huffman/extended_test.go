@@ -0,0 +1,94 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// lowEntropyInput returns data dominated by one byte, where a prefix code
+// over single bytes cannot spend less than a bit on each.
+func lowEntropyInput() []byte {
+	random := rand.New(rand.NewSource(1))
+
+	input := make([]byte, 100000)
+	for i := range input {
+		input[i] = '0'
+		if random.Intn(30) == 0 {
+			input[i] = byte('1' + random.Intn(3))
+		}
+	}
+	return input
+}
+
+func TestExtendedRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"single":     []byte("a"),
+		"pair":       []byte("ab"),
+		"run":        bytes.Repeat([]byte("z"), 5001),
+		"lowEntropy": lowEntropyInput(),
+		"text":       benchmarkInput(),
+	}
+
+	for name, input := range inputs {
+		compressed := compressBytes(t, input, WriterOptions{Alphabet: AlphabetExtended, BlockSize: 1 << 16})
+
+		reader, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := io.ReadAll(iotestHalfReader{reader})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(output, input) {
+			t.Errorf("%s: round trip mismatch: got %d bytes, expected %d", name, len(output), len(input))
+		}
+	}
+}
+
+func TestExtendedSymbols(t *testing.T) {
+	input := bytes.Repeat([]byte("abcabx"), 100)
+
+	symbols, sequences := extendedSymbols(input, 1<<DefaultMaxCodeLength)
+	if len(sequences) == 0 {
+		t.Fatal("no extended symbols chosen")
+	}
+	if len(symbols) >= len(input)/2 {
+		t.Errorf("%d bytes parsed into %d symbols", len(input), len(symbols))
+	}
+
+	var expanded []byte
+	for _, symbol := range symbols {
+		if symbol >= firstWordSymbol {
+			expanded = append(expanded, sequences[symbol-firstWordSymbol]...)
+		} else {
+			expanded = append(expanded, byte(symbol))
+		}
+	}
+	if !bytes.Equal(expanded, input) {
+		t.Errorf("symbols expand to %q, expected %q", expanded, input)
+	}
+
+	// Sequences too rare to pay for their listing fall back to bytes.
+	if _, sequences := extendedSymbols([]byte("abcdefgh"), 1<<DefaultMaxCodeLength); len(sequences) != 0 {
+		t.Errorf("extended symbols %q chosen from unique pairs", sequences)
+	}
+}
+
+// TestExtendedBeatsOrder0 checks that extended symbols get below the bit per
+// byte that coding single bytes needs on low-entropy input.
+func TestExtendedBeatsOrder0(t *testing.T) {
+	input := lowEntropyInput()
+
+	byteSize := len(compressBytes(t, input, WriterOptions{}))
+	extendedSize := len(compressBytes(t, input, WriterOptions{Alphabet: AlphabetExtended}))
+
+	if byteSize*8 < len(input) {
+		t.Fatalf("byte alphabet wrote %d bytes for %d input bytes", byteSize, len(input))
+	}
+	if extendedSize >= byteSize*3/4 {
+		t.Errorf("extended alphabet wrote %d bytes, byte alphabet %d", extendedSize, byteSize)
+	}
+}
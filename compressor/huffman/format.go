@@ -0,0 +1,378 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// A compressed file is laid out as follows, with all integers big-endian:
+//
+//	magic     [4]byte  "HUF\x1a"
+//	version   uint8    formatVersion
+//	flags     uint8    combination of the flag bits below
+//	method    uint8    the Method every block is coded with
+//	coder     uint8    the Coder every block's symbols are coded with
+//	alphabet  uint8    the Alphabet of MethodHuffman blocks
+//	metadata  ...      only with flagMetadata, see writeMetadata
+//	blocks    ...      any number of blocks, each coded on its own
+//	end       ...      blockMarker and a zero uint32, ending the blocks
+//	size      uint64   length of the original data in bytes
+//	checksum  uint32   CRC-32 (IEEE) of the original data
+//	index     ...      only with flagIndex, see below
+//
+// Each block is laid out as:
+//
+//	marker    [6]byte  blockMarker
+//	length    uint32   number of original bytes in the block, never zero
+//	start     uint64   offset of the block's first byte in the original data
+//	size      uint32   length of the body in bytes
+//	checksum  uint32   CRC-32 (IEEE) of the block's original data
+//	flags     uint8    combination of the block flag bits below
+//	hcrc      uint32   CRC-32 (IEEE) of the block header up to here
+//	body      ...      coded data, in a layout that depends on the method
+//
+// A block with blockStored holds its original data as the body, uncoded.
+// The writer stores any block that coding would not make smaller, so
+// incompressible data grows by the framing alone: 31 bytes for every block
+// header, 31 bytes per file for the header, end marker and trailer, 14 bytes
+// and the name for the metadata, and 12 bytes per block and 12 more for an
+// index. A 1-byte file thus compresses to 63 bytes before metadata, and 5 MB
+// of random data, in five 1 MiB blocks, grows by 186 bytes.
+//
+// The checksum of each block lets a reader tell which block is damaged, and
+// stop before passing on more than one block of bad data. The marker, start
+// offset and header checksum let Recover find the intact blocks past damage
+// and put them back in place.
+//
+// With CoderHuffman, a MethodHuffman body holds a uint16 symbol count and
+// (symbol, code length) byte pairs, followed by the concatenated codes, and a
+// MethodAdaptive body holds just the codes. A MethodLZ body holds the size of
+// the distance alphabet as a byte, one code length byte for every
+// literal/length symbol and every distance symbol, and then the codes, each
+// match followed by its extra bits. Codes are zero-padded to a byte boundary;
+// the decoder stops after length symbols, so the padding bits never need to
+// be recorded. A MethodContext body holds the number of tables as a byte, the
+// table of each of the 256 preceding-byte contexts, and then Huffman-coded
+// code lengths for every table, followed by the codes. A MethodBWT body holds
+// the primary index of the Burrows–Wheeler transform as a uint32, one code
+// length byte for each of the 257 run-length symbols, and the codes.
+//
+// With CoderRange, the code lengths are replaced by a uvarint frequency for
+// every symbol of each alphabet, and the codes by the output of a range
+// coder. A MethodHuffman body then codes a single alphabet of 256 symbols.
+// MethodAdaptive and MethodContext are only coded with CoderHuffman.
+//
+// Alphabets other than AlphabetByte are only used with MethodHuffman and
+// CoderHuffman. The body then lists the words of an AlphabetWord block, or
+// the extended symbols of an AlphabetExtended block, as a uvarint count and
+// uvarint-prefixed byte strings, and holds a uvarint symbol count and
+// (uvarint gap to the previous symbol, code length byte) pairs in place of
+// the (symbol, code length) byte pairs.
+//
+// The optional block index lets a reader find the block holding any offset
+// without scanning the file. It is found through its offset, stored in the
+// last eight bytes:
+//
+//	count     uint32   number of blocks
+//	entries   ...      (file offset uint64, length uint32) for every block
+//	offset    uint64   file offset of the count field
+var magic = [4]byte{'H', 'U', 'F', 0x1a}
+
+const formatVersion uint8 = 9
+
+const (
+	// flagIndex marks a file that ends with a block index.
+	flagIndex uint8 = 1 << iota
+
+	// flagMetadata marks a file whose header records a Header.
+	flagMetadata
+)
+
+// knownFlags holds every flag bit this version understands.
+const knownFlags = flagIndex | flagMetadata
+
+// maxBlockSize is the largest block length the format allows.
+const maxBlockSize = 1 << 30
+
+var (
+	// ErrFormat is returned when the input does not start with the magic number.
+	ErrFormat = errors.New("huffman: not a compressed file")
+
+	// ErrVersion is returned when the input uses an unsupported format version.
+	ErrVersion = errors.New("huffman: unsupported format version")
+
+	// ErrHeader is returned when the header contains invalid or unknown fields.
+	ErrHeader = errors.New("huffman: invalid header")
+
+	// ErrChecksum is returned when the decompressed data does not match the
+	// checksum recorded in the trailer.
+	ErrChecksum = errors.New("huffman: checksum mismatch")
+
+	// ErrCorrupt is returned when coded data is malformed in a way no
+	// Writer produces, such as an invalid code, a match reaching before the
+	// start of the data, or a block body that runs out before its symbols
+	// do. Malformed DEFLATE data in a gzip file is reported the same way.
+	ErrCorrupt = errors.New("huffman: corrupt compressed data")
+)
+
+// fileHeaderSize is the length of the magic number, version, flags, method,
+// coder and alphabet, which is all of the header without flagMetadata.
+const fileHeaderSize = 9
+
+type fileHeader struct {
+	version  uint8
+	flags    uint8
+	method   Method
+	coder    Coder
+	alphabet Alphabet
+	metadata Header
+}
+
+// size returns the length of the header in bytes.
+func (header fileHeader) size() int64 {
+	if header.flags&flagMetadata == 0 {
+		return fileHeaderSize
+	}
+	return fileHeaderSize + int64(metadataSize(header.metadata))
+}
+
+func writeFileHeader(w io.Writer, header fileHeader) error {
+
+	if _, err := w.Write(magic[:]); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, header.version); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, header.flags); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, header.method); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, header.coder); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, header.alphabet); err != nil {
+		return err
+	}
+
+	if header.flags&flagMetadata != 0 {
+		return writeMetadata(w, header.metadata)
+	}
+
+	return nil
+}
+
+func readFileHeader(r io.Reader) (fileHeader, error) {
+
+	var header fileHeader
+
+	var fileMagic [4]byte
+	if _, err := io.ReadFull(r, fileMagic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return header, ErrFormat
+		}
+		return header, err
+	}
+	if fileMagic != magic {
+		return header, ErrFormat
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &header.version); err != nil {
+		return header, noEOF(err)
+	}
+	if header.version != formatVersion {
+		return header, fmt.Errorf("%w %d", ErrVersion, header.version)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &header.flags); err != nil {
+		return header, noEOF(err)
+	}
+	if header.flags&^knownFlags != 0 {
+		return header, fmt.Errorf("%w: unknown flags %#02x", ErrHeader, header.flags&^knownFlags)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &header.method); err != nil {
+		return header, noEOF(err)
+	}
+	if !header.method.valid() {
+		return header, fmt.Errorf("%w: unknown method %d", ErrHeader, header.method)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &header.coder); err != nil {
+		return header, noEOF(err)
+	}
+	if !header.coder.valid() || (header.coder != CoderHuffman && !header.method.supportsCoders()) {
+		return header, fmt.Errorf("%w: unknown coder %d for the %v method", ErrHeader, header.coder, header.method)
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &header.alphabet); err != nil {
+		return header, noEOF(err)
+	}
+	if !header.alphabet.valid() || (header.alphabet != AlphabetByte && (header.method != MethodHuffman || header.coder != CoderHuffman)) {
+		return header, fmt.Errorf("%w: unknown alphabet %d for the %v method and %v coder", ErrHeader, header.alphabet, header.method, header.coder)
+	}
+
+	if header.flags&flagMetadata != 0 {
+		metadata, err := readMetadata(r)
+		if err != nil {
+			return header, err
+		}
+		header.metadata = metadata
+	}
+
+	return header, nil
+}
+
+// blockMarker starts every block and the end-of-blocks marker, so that
+// blocks can be found again by scanning for it. Like bzip2's block magic, it
+// is the start of the decimal digits of pi.
+var blockMarker = [6]byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+
+const (
+	// blockHeaderSize is the length of the fields in front of a block body.
+	blockHeaderSize = 31
+
+	// endMarkerSize is the length of the end-of-blocks marker.
+	endMarkerSize = 10
+)
+
+// blockStored marks a block whose body is its original data.
+const blockStored uint8 = 1
+
+type blockHeader struct {
+	length   uint32
+	start    uint64
+	size     uint32
+	checksum uint32
+	flags    uint8
+}
+
+// writeBlockHeader writes the fields in front of a block body, or the
+// end-of-blocks marker for a zero length.
+func writeBlockHeader(w io.Writer, h blockHeader) error {
+
+	var buf [blockHeaderSize]byte
+	copy(buf[:], blockMarker[:])
+	binary.BigEndian.PutUint32(buf[6:], h.length)
+	if h.length == 0 {
+		_, err := w.Write(buf[:endMarkerSize])
+		return err
+	}
+	binary.BigEndian.PutUint64(buf[10:], h.start)
+	binary.BigEndian.PutUint32(buf[18:], h.size)
+	binary.BigEndian.PutUint32(buf[22:], h.checksum)
+	buf[26] = h.flags
+	binary.BigEndian.PutUint32(buf[27:], crc32.ChecksumIEEE(buf[:27]))
+
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readBlockHeader reads the fields in front of a block body, or returns a
+// zero length if r is at the end-of-blocks marker.
+func readBlockHeader(r io.Reader) (blockHeader, error) {
+
+	var h blockHeader
+
+	var buf [blockHeaderSize]byte
+	if _, err := io.ReadFull(r, buf[:endMarkerSize]); err != nil {
+		return h, noEOF(err)
+	}
+	if [6]byte(buf[:6]) != blockMarker {
+		return h, fmt.Errorf("%w: missing block marker", ErrHeader)
+	}
+	h.length = binary.BigEndian.Uint32(buf[6:])
+	if h.length == 0 {
+		return h, nil
+	}
+
+	if _, err := io.ReadFull(r, buf[endMarkerSize:]); err != nil {
+		return h, noEOF(err)
+	}
+	if binary.BigEndian.Uint32(buf[27:]) != crc32.ChecksumIEEE(buf[:27]) {
+		return h, fmt.Errorf("%w: block header checksum mismatch", ErrHeader)
+	}
+	h.start = binary.BigEndian.Uint64(buf[10:])
+	h.size = binary.BigEndian.Uint32(buf[18:])
+	h.checksum = binary.BigEndian.Uint32(buf[22:])
+	h.flags = buf[26]
+
+	if h.length > maxBlockSize {
+		return h, fmt.Errorf("%w: block of %d bytes", ErrHeader, h.length)
+	}
+	if h.size > 2*maxBlockSize {
+		return h, fmt.Errorf("%w: block body of %d bytes", ErrHeader, h.size)
+	}
+	if h.flags&^blockStored != 0 {
+		return h, fmt.Errorf("%w: unknown block flags %#x", ErrHeader, h.flags)
+	}
+	if h.flags&blockStored != 0 && h.size != h.length {
+		return h, fmt.Errorf("%w: stored block of %d bytes with a body of %d", ErrHeader, h.length, h.size)
+	}
+
+	return h, nil
+}
+
+// A BlockError reports a block of a compressed file that could not be
+// decoded, or whose data does not match its checksum.
+type BlockError struct {
+	// Block is the index of the block, Offset where it starts in the
+	// compressed file and Start the offset of its first original byte.
+	Block  int
+	Offset int64
+	Start  int64
+
+	Err error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("huffman: block %d at offset %d, holding original data from offset %d: %s",
+		e.Block, e.Offset, e.Start, strings.TrimPrefix(e.Err.Error(), "huffman: "))
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+type trailer struct {
+	size     uint64
+	checksum uint32
+}
+
+func writeTrailer(w io.Writer, t trailer) error {
+	if err := binary.Write(w, binary.BigEndian, t.size); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, t.checksum)
+}
+
+func readTrailer(r io.Reader) (trailer, error) {
+	var t trailer
+	if err := binary.Read(r, binary.BigEndian, &t.size); err != nil {
+		return t, noEOF(err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &t.checksum); err != nil {
+		return t, noEOF(err)
+	}
+	return t, nil
+}
+
+// noEOF turns a clean end of input into io.ErrUnexpectedEOF, since running
+// out of data anywhere past the magic number means the file is truncated.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Format selects the container a Writer produces.
+type Format uint8
+
+const (
+	// FormatNative is this package's own block format, described in
+	// format.go.
+	FormatNative Format = iota
+
+	// FormatGzip is a gzip file (RFC 1952) holding a DEFLATE stream
+	// (RFC 1951) with dynamic Huffman blocks, readable by any gzip tool.
+	FormatGzip
+)
+
+var formatNames = map[Format]string{
+	FormatNative: "native",
+	FormatGzip:   "gzip",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", uint8(f))
+}
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	for format, formatName := range formatNames {
+		if formatName == name {
+			return format, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown format %q", name)
+}
+
+func (f Format) valid() bool {
+	_, ok := formatNames[f]
+	return ok
+}
+
+// gzip header fields and flags.
+const (
+	gzipID1     = 0x1f
+	gzipID2     = 0x8b
+	gzipDeflate = 8
+
+	gzipFlagText    = 1 << 0
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+
+	gzipOSUnknown = 255
+)
+
+// gzipFinalBlock is an empty final DEFLATE block with fixed codes: BFINAL 1,
+// BTYPE 01 and the seven-bit end-of-block code.
+var gzipFinalBlock = []byte{0x03, 0x00}
+
+// writeGzipHeader writes a gzip member header recording the name and
+// modification time of h. Gzip has no field for the mode.
+func writeGzipHeader(w io.Writer, h Header) error {
+	header := [10]byte{gzipID1, gzipID2, gzipDeflate, 0, 0, 0, 0, 0, 0, gzipOSUnknown}
+	if h.Name != "" {
+		if strings.IndexByte(h.Name, 0) >= 0 {
+			return fmt.Errorf("huffman: gzip cannot record a name containing a zero byte")
+		}
+		header[3] |= gzipFlagName
+	}
+	if !h.ModTime.IsZero() && h.ModTime.Unix() > 0 && h.ModTime.Unix() <= math.MaxUint32 {
+		binary.LittleEndian.PutUint32(header[4:], uint32(h.ModTime.Unix()))
+	}
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if h.Name != "" {
+		if _, err := io.WriteString(w, h.Name+"\x00"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeGzipTrailer(w io.Writer, checksum uint32, size uint64) error {
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[0:], checksum)
+	binary.LittleEndian.PutUint32(trailer[4:], uint32(size))
+	_, err := w.Write(trailer[:])
+	return err
+}
+
+// readGzipHeader reads a gzip member header, returning its name and
+// modification time and skipping the other optional fields. The two ID bytes
+// must already have been consumed.
+func readGzipHeader(r *bufio.Reader) (Header, error) {
+
+	var h Header
+
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return h, noEOF(err)
+	}
+	if header[0] != gzipDeflate {
+		return h, fmt.Errorf("%w: gzip compression method %d", ErrHeader, header[0])
+	}
+	flags := header[1]
+	if modTime := binary.LittleEndian.Uint32(header[2:]); modTime != 0 {
+		h.ModTime = time.Unix(int64(modTime), 0)
+	}
+
+	if flags&gzipFlagExtra != 0 {
+		var length uint16
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return h, noEOF(err)
+		}
+		if _, err := r.Discard(int(length)); err != nil {
+			return h, noEOF(err)
+		}
+	}
+
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag != 0 {
+			field, err := r.ReadBytes(0)
+			if err != nil {
+				return h, noEOF(err)
+			}
+			if flag == gzipFlagName {
+				h.Name = string(field[:len(field)-1])
+			}
+		}
+	}
+
+	if flags&gzipFlagHCRC != 0 {
+		if _, err := r.Discard(2); err != nil {
+			return h, noEOF(err)
+		}
+	}
+
+	return h, nil
+}
+
+// gzipReader decompresses gzip members one after another, as gzip does for
+// concatenated files, checking each member's CRC-32 and size.
+type gzipReader struct {
+	// header is the header of the first member.
+	header Header
+
+	r        *bufio.Reader
+	inflater *inflater
+	digest   hash.Hash32
+
+	// size is the length of the current member's data, and total that of
+	// every member so far.
+	size  uint64
+	total uint64
+}
+
+func newGzipReader(r *bufio.Reader) (*gzipReader, error) {
+	header, err := readGzipHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipReader{header: header, r: r, inflater: newInflater(r), digest: crc32.NewIEEE()}, nil
+}
+
+func (z *gzipReader) Read(p []byte) (int, error) {
+	for {
+		n, err := z.inflater.Read(p)
+		z.digest.Write(p[:n])
+		z.size += uint64(n)
+		z.total += uint64(n)
+		if err != io.EOF {
+			return n, err
+		}
+
+		if err := z.verifyTrailer(); err != nil {
+			return n, err
+		}
+
+		// Another member may follow.
+		id, err := z.r.Peek(2)
+		if len(id) < 2 || id[0] != gzipID1 || id[1] != gzipID2 {
+			if err == nil || err == io.EOF {
+				return n, io.EOF
+			}
+			return n, err
+		}
+		z.r.Discard(2)
+		if _, err := readGzipHeader(z.r); err != nil {
+			return n, err
+		}
+		z.inflater = newInflater(z.r)
+		z.digest.Reset()
+		z.size = 0
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (z *gzipReader) verifyTrailer() error {
+
+	var trailer [8]byte
+	if _, err := io.ReadFull(z.r, trailer[:]); err != nil {
+		return noEOF(err)
+	}
+
+	if binary.LittleEndian.Uint32(trailer[0:]) != z.digest.Sum32() || binary.LittleEndian.Uint32(trailer[4:]) != uint32(z.size) {
+		return ErrChecksum
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package huffman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compressor/bitio"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func gzipTestInputs() map[string][]byte {
+	random := rand.New(rand.NewSource(1))
+
+	noise := make([]byte, 70000)
+	random.Read(noise)
+
+	var text bytes.Buffer
+	words := []string{"deflate ", "gzip ", "inflate ", "huffman ", "block ", "window\n"}
+	for text.Len() < 300000 {
+		text.WriteString(words[random.Intn(len(words))])
+	}
+
+	return map[string][]byte{
+		"empty":  {},
+		"byte":   []byte("x"),
+		"run":    bytes.Repeat([]byte("a"), 100000),
+		"noise":  noise,
+		"text":   text.Bytes(),
+		"binary": bytes.Repeat([]byte{0, 1, 2, 3, 255, 254, 0, 0}, 5000),
+	}
+}
+
+// TestGzipWriterStandardReader checks that the standard library decompresses
+// what FormatGzip writes.
+func TestGzipWriterStandardReader(t *testing.T) {
+	for name, input := range gzipTestInputs() {
+		for _, method := range []Method{MethodHuffman, MethodLZ} {
+			compressed := compressBytes(t, input, WriterOptions{Format: FormatGzip, Method: method, BlockSize: 65536})
+
+			reader, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("%s, %s: gzip.NewReader: %v", name, method, err)
+			}
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, method, err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("%s, %s: standard reader returned %d bytes, expected %d", name, method, len(output), len(input))
+			}
+		}
+	}
+}
+
+// TestReaderStandardGzip checks that Reader decompresses gzip files written
+// by the standard library at every kind of compression level, including
+// concatenated members.
+func TestReaderStandardGzip(t *testing.T) {
+	levels := []int{gzip.NoCompression, gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression, gzip.HuffmanOnly}
+
+	for name, input := range gzipTestInputs() {
+		for _, level := range levels {
+			var compressed bytes.Buffer
+			for member := 0; member < 2; member++ {
+				writer, _ := gzip.NewWriterLevel(&compressed, level)
+				writer.Write(input)
+				writer.Close()
+			}
+
+			reader, err := NewReader(&compressed)
+			if err != nil {
+				t.Fatalf("%s, level %d: NewReader: %v", name, level, err)
+			}
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("%s, level %d: %v", name, level, err)
+			}
+			if expected := append(bytes.Clone(input), input...); !bytes.Equal(output, expected) {
+				t.Errorf("%s, level %d: got %d bytes, expected %d", name, level, len(output), len(expected))
+			}
+		}
+	}
+}
+
+func TestReaderGzipChecksum(t *testing.T) {
+	compressed := compressBytes(t, []byte("checked by the gzip trailer"), WriterOptions{Format: FormatGzip})
+	compressed[len(compressed)-5] ^= 0xff
+
+	reader, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrChecksum) {
+		t.Errorf("ReadAll error = %v, expected %v", err, ErrChecksum)
+	}
+}
+
+// TestReaderGzipCorrupt checks that malformed DEFLATE data is reported as
+// ErrCorrupt, and a stream cut short as io.ErrUnexpectedEOF.
+func TestReaderGzipCorrupt(t *testing.T) {
+	compressed := compressBytes(t, bytes.Repeat([]byte("inflated from a damaged stream\n"), 50), WriterOptions{Format: FormatGzip})
+
+	read := func(data []byte) error {
+		reader, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(reader)
+		return err
+	}
+
+	// The first DEFLATE block follows the 10-byte gzip header; type 3 is
+	// reserved.
+	reserved := bytes.Clone(compressed)
+	reserved[10] |= 0x06
+	if err := read(reserved); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("reserved block type: error = %v, expected ErrCorrupt", err)
+	}
+
+	for i := 10; i < len(compressed)-8; i++ {
+		data := bytes.Clone(compressed)
+		data[i] ^= 0xff
+		err := read(data)
+		if err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrChecksum) && err != io.ErrUnexpectedEOF {
+			t.Errorf("byte %d flipped: untyped error %v", i, err)
+		}
+	}
+
+	if err := read(compressed[:len(compressed)/2]); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated stream: error = %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// TestReaderGzipLimits checks that the limits count the data of every
+// member, and that a single DEFLATE block of a great deal of output is
+// inflated a window at a time rather than all at once.
+func TestReaderGzipLimits(t *testing.T) {
+
+	var members bytes.Buffer
+	for i := 0; i < 10; i++ {
+		writer := gzip.NewWriter(&members)
+		writer.Write(bytes.Repeat([]byte{byte('a' + i)}, 1000))
+		writer.Close()
+	}
+	reader, err := NewReaderOptions(&members, ReaderOptions{MaxSize: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(io.Discard, reader)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || n != 2000 {
+		t.Errorf("ten members with MaxSize 2000: read %d bytes, %v", n, err)
+	}
+
+	// One fixed-code DEFLATE block of 20 MiB of zeros: a literal and then
+	// matches of 258 bytes at distance 1.
+	var zeros bytes.Buffer
+	writeGzipHeader(&zeros, Header{})
+	bw := bitio.NewLSBWriter(&zeros)
+	bw.WriteBits(1, 1) // BFINAL
+	bw.WriteBits(1, 2) // BTYPE: fixed Huffman codes
+	writeDeflateCode(bw, bitio.Code{Bits: 0x30, Length: 8})
+	for i := 0; i < 20<<20/258; i++ {
+		writeDeflateCode(bw, bitio.Code{Bits: 0xc5, Length: 8})
+		writeDeflateCode(bw, bitio.Code{Bits: 0, Length: 5})
+	}
+	writeDeflateCode(bw, bitio.Code{Bits: 0, Length: 7})
+	bw.Flush()
+
+	reader, err = NewReaderOptions(&zeros, ReaderOptions{MaxSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Read(make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if buffered := cap(reader.gzip.inflater.out); buffered > 4*inflateHistory {
+		t.Errorf("first Read buffered %d bytes of output", buffered)
+	}
+	if n, err := io.Copy(io.Discard, reader); !errors.As(err, &limitErr) || 4096+n != 1<<20 {
+		t.Errorf("20 MiB of zeros with MaxSize 1 MiB: read %d bytes, %v", 4096+n, err)
+	}
+}
@@ -0,0 +1,85 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Header describes the original file, like the header of a gzip file. A
+// Writer records it when any field is set, and a Reader fills it in from
+// the file it reads. Mode holds only permission bits.
+type Header struct {
+	Name    string
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+func (h Header) empty() bool {
+	return h.Name == "" && h.Mode == 0 && h.ModTime.IsZero()
+}
+
+// metadataSize returns the length of the metadata written for h.
+func metadataSize(h Header) int {
+	return 2 + len(h.Name) + 4 + 8
+}
+
+// writeMetadata writes h as a uint16-prefixed name, the mode as a uint32 and
+// the modification time as int64 nanoseconds since the Unix epoch, zero
+// meaning unknown.
+func writeMetadata(w io.Writer, h Header) error {
+
+	if len(h.Name) > 1<<16-1 {
+		return fmt.Errorf("huffman: name of %d bytes is too long for the header", len(h.Name))
+	}
+
+	var modTime int64
+	if !h.ModTime.IsZero() {
+		modTime = h.ModTime.UnixNano()
+	}
+
+	if err := binary.Write(w, binary.BigEndian, uint16(len(h.Name))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, h.Name); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(h.Mode.Perm())); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, modTime)
+}
+
+func readMetadata(r io.Reader) (Header, error) {
+
+	var h Header
+
+	var nameLength uint16
+	if err := binary.Read(r, binary.BigEndian, &nameLength); err != nil {
+		return h, noEOF(err)
+	}
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return h, noEOF(err)
+	}
+	h.Name = string(name)
+
+	var fields struct {
+		Mode    uint32
+		ModTime int64
+	}
+	if err := binary.Read(r, binary.BigEndian, &fields); err != nil {
+		return h, noEOF(err)
+	}
+	if fs.FileMode(fields.Mode) != fs.FileMode(fields.Mode).Perm() {
+		return h, fmt.Errorf("%w: file mode %#o", ErrHeader, fields.Mode)
+	}
+	h.Mode = fs.FileMode(fields.Mode)
+	if fields.ModTime != 0 {
+		h.ModTime = time.Unix(0, fields.ModTime)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,141 @@
+package huffman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// compressWithHeader compresses input with the Writer's Header set to h.
+func compressWithHeader(t *testing.T, input []byte, h Header, options WriterOptions) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	writer, err := NewWriterOptions(&compressed, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Header = h
+	if _, err := writer.Write(input); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	input := bytes.Repeat([]byte("metadata travels in the header\n"), 100)
+	h := Header{Name: "notes.txt", Mode: 0o640, ModTime: time.Date(2021, 5, 6, 7, 8, 9, 10, time.UTC)}
+
+	for _, index := range []bool{false, true} {
+		compressed := compressWithHeader(t, input, h, WriterOptions{BlockSize: 1000, Index: index})
+
+		reader, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reader.Name != h.Name || reader.Mode != h.Mode || !reader.ModTime.Equal(h.ModTime) {
+			t.Errorf("index %v: Reader.Header = %+v, expected %+v", index, reader.Header, h)
+		}
+		output, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(output, input) {
+			t.Errorf("index %v: round trip mismatch", index)
+		}
+
+		// The blocks start after the metadata, with or without an index.
+		readerAt, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 100)
+		if _, err := readerAt.ReadAt(p, 1950); err != nil || !bytes.Equal(p, input[1950:2050]) {
+			t.Errorf("index %v: ReadAt returned %q, %v", index, p, err)
+		}
+	}
+
+	// Without a Header nothing is recorded.
+	reader, err := NewReader(bytes.NewReader(compressBytes(t, input, WriterOptions{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reader.Header.empty() {
+		t.Errorf("Reader.Header = %+v, expected none", reader.Header)
+	}
+}
+
+func TestGzipHeader(t *testing.T) {
+	h := Header{Name: "notes.txt", ModTime: time.Unix(1620284889, 0)}
+	compressed := compressWithHeader(t, []byte("gzip records the name and time"), h, WriterOptions{Format: FormatGzip})
+
+	standard, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if standard.Name != h.Name || !standard.ModTime.Equal(h.ModTime) {
+		t.Errorf("standard reader found name %q and time %v", standard.Name, standard.ModTime)
+	}
+
+	reader, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Name != h.Name || !reader.ModTime.Equal(h.ModTime) {
+		t.Errorf("Reader.Header = %+v, expected %+v", reader.Header, h)
+	}
+}
+
+// TestEncodeDecodeMetadata checks that the permissions and modification time
+// of a file survive compression and decompression.
+func TestEncodeDecodeMetadata(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "original.txt")
+	if err := os.WriteFile(filename, []byte("restored with its metadata"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	compressedFilename := filepath.Join(dir, "original.txt.huf")
+	if err := Encode(filename, compressedFilename, WriterOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	inputFile, err := os.Open(compressedFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inputFile.Close()
+	reader, err := NewReader(inputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Name != "original.txt" {
+		t.Errorf("recorded name %q, expected %q", reader.Name, "original.txt")
+	}
+
+	outputFilename := filepath.Join(dir, "restored.txt")
+	if err := Decode(compressedFilename, outputFilename, ReaderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(outputFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("restored mode %v, expected %v", info.Mode().Perm(), os.FileMode(0o600))
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("restored mtime %v, expected %v", info.ModTime(), modTime)
+	}
+}
@@ -0,0 +1,234 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+)
+
+// indexEntry locates one block: its offset in the compressed file, and the
+// offset and length of the original data it holds.
+type indexEntry struct {
+	offset int64
+	start  int64
+	length int
+}
+
+func writeIndex(w io.Writer, indexOffset int64, entries []indexEntry) error {
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(entries))); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := binary.Write(w, binary.BigEndian, uint64(entry.offset)); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(entry.length)); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, binary.BigEndian, uint64(indexOffset))
+}
+
+// readIndex reads the block index at the end of a file of the given size.
+func readIndex(r io.ReaderAt, size int64) ([]indexEntry, error) {
+
+	var footer [8]byte
+	if _, err := r.ReadAt(footer[:], size-8); err != nil {
+		return nil, noEOF(err)
+	}
+
+	indexOffset := int64(binary.BigEndian.Uint64(footer[:]))
+	if indexOffset < fileHeaderSize || indexOffset > size-12 {
+		return nil, fmt.Errorf("%w: index offset %d out of range", ErrHeader, indexOffset)
+	}
+
+	index := bufio.NewReader(io.NewSectionReader(r, indexOffset, size-8-indexOffset))
+
+	var count uint32
+	if err := binary.Read(index, binary.BigEndian, &count); err != nil {
+		return nil, noEOF(err)
+	}
+	if int64(count) > (size-12-indexOffset)/12 {
+		return nil, fmt.Errorf("%w: index of %d blocks does not fit the file", ErrHeader, count)
+	}
+
+	entries := make([]indexEntry, count)
+	start := int64(0)
+	for i := range entries {
+		var offset uint64
+		if err := binary.Read(index, binary.BigEndian, &offset); err != nil {
+			return nil, noEOF(err)
+		}
+		var length uint32
+		if err := binary.Read(index, binary.BigEndian, &length); err != nil {
+			return nil, noEOF(err)
+		}
+		if offset < fileHeaderSize || offset >= uint64(indexOffset) || length == 0 || length > maxBlockSize {
+			return nil, fmt.Errorf("%w: invalid index entry %d", ErrHeader, i)
+		}
+
+		entries[i] = indexEntry{offset: int64(offset), start: start, length: int(length)}
+		start += int64(length)
+	}
+
+	return entries, nil
+}
+
+// scanBlocks builds the index of a file without one by walking the block
+// headers, skipping over every payload.
+func scanBlocks(r io.ReaderAt, offset int64, size int64) ([]indexEntry, error) {
+
+	var entries []indexEntry
+
+	start := int64(0)
+	for {
+		section := io.NewSectionReader(r, offset, size-offset)
+
+		h, err := readBlockHeader(section)
+		if err != nil {
+			return nil, err
+		}
+		if h.length == 0 {
+			return entries, nil
+		}
+
+		entries = append(entries, indexEntry{offset: offset, start: start, length: int(h.length)})
+		offset += blockHeaderSize + int64(h.size)
+		start += int64(h.length)
+	}
+}
+
+// A ReaderAt gives random access to the original data of a compressed file.
+// A read decodes only the blocks that overlap the requested range, located
+// through the block index when the file has one and by scanning the block
+// headers once otherwise. It is safe for concurrent use.
+type ReaderAt struct {
+	r        io.ReaderAt
+	fileSize int64
+	header   fileHeader
+	entries  []indexEntry
+	size     int64
+	options  ReaderOptions
+
+	// The most recently decoded block, which serves runs of small reads.
+	mu          sync.Mutex
+	cachedEntry int
+	cached      []byte
+}
+
+// NewReaderAt returns a ReaderAt for the compressed file of the given size
+// read through r.
+func NewReaderAt(r io.ReaderAt, size int64) (*ReaderAt, error) {
+	return NewReaderAtOptions(r, size, ReaderOptions{})
+}
+
+// NewReaderAtOptions is like NewReaderAt but refuses, with a *LimitError,
+// to decode any block that breaks the given limits on its own.
+func NewReaderAtOptions(r io.ReaderAt, size int64, options ReaderOptions) (*ReaderAt, error) {
+
+	header, err := readFileHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []indexEntry
+	if header.flags&flagIndex != 0 {
+		entries, err = readIndex(r, size)
+	} else {
+		entries, err = scanBlocks(r, header.size(), size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	z := &ReaderAt{r: r, fileSize: size, entries: entries, options: options, cachedEntry: -1}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		z.size = last.start + int64(last.length)
+	}
+	z.header = header
+
+	return z, nil
+}
+
+// Size returns the length of the original data.
+func (z *ReaderAt) Size() int64 {
+	return z.size
+}
+
+// ReadAt reads len(p) bytes of original data starting at offset off.
+func (z *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+
+	if off < 0 {
+		return 0, errors.New("huffman: negative offset")
+	}
+
+	// Find the first block that ends after off.
+	i := sort.Search(len(z.entries), func(i int) bool {
+		return z.entries[i].start+int64(z.entries[i].length) > off
+	})
+
+	n := 0
+	for ; n < len(p) && i < len(z.entries); i++ {
+		data, err := z.blockData(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[off+int64(n)-z.entries[i].start:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// blockData returns the decoded contents of block i.
+func (z *ReaderAt) blockData(i int) ([]byte, error) {
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.cachedEntry == i {
+		return z.cached, nil
+	}
+
+	entry := z.entries[i]
+	section := bufio.NewReader(io.NewSectionReader(z.r, entry.offset, z.fileSize-entry.offset))
+
+	blockError := func(err error) error {
+		return &BlockError{Block: i, Offset: entry.offset, Start: entry.start, Err: err}
+	}
+
+	block, err := readBlock(section, z.header)
+	if err != nil {
+		return nil, blockError(err)
+	}
+	if block == nil || block.length != entry.length || block.start != uint64(entry.start) {
+		return nil, blockError(fmt.Errorf("%w: block does not match the index", ErrHeader))
+	}
+	if err := z.options.check(int64(block.length), block.size); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, block.length)
+	if _, err := block.decode(data); err != nil {
+		return nil, blockError(err)
+	}
+	if crc32.ChecksumIEEE(data) != block.checksum {
+		return nil, blockError(ErrChecksum)
+	}
+
+	z.cachedEntry, z.cached = i, data
+
+	return data, nil
+}
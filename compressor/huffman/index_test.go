@@ -0,0 +1,55 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestReaderAt reads ranges that start, end and straddle block boundaries,
+// with and without a block index.
+func TestReaderAt(t *testing.T) {
+	var input []byte
+	for i := 0; i < 5000; i++ {
+		input = append(input, byte('a'+i%26), byte(i), '\n')
+	}
+
+	for _, index := range []bool{false, true} {
+		compressed := compressBytes(t, input, WriterOptions{BlockSize: 1000, Index: index})
+
+		reader, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)))
+		if err != nil {
+			t.Fatalf("index %v: NewReaderAt: %v", index, err)
+		}
+		if reader.Size() != int64(len(input)) {
+			t.Errorf("index %v: Size() = %d, expected %d", index, reader.Size(), len(input))
+		}
+
+		ranges := []struct{ offset, length int }{
+			{0, 10}, {995, 10}, {1000, 1000}, {2500, 5000}, {len(input) - 7, 7}, {0, len(input)},
+		}
+		for _, r := range ranges {
+			p := make([]byte, r.length)
+			if _, err := reader.ReadAt(p, int64(r.offset)); err != nil {
+				t.Fatalf("index %v: ReadAt(%d, %d): %v", index, r.offset, r.length, err)
+			}
+			if !bytes.Equal(p, input[r.offset:r.offset+r.length]) {
+				t.Errorf("index %v: ReadAt(%d, %d) returned the wrong data", index, r.offset, r.length)
+			}
+		}
+
+		p := make([]byte, 10)
+		if n, err := reader.ReadAt(p, int64(len(input)-4)); n != 4 || err != io.EOF {
+			t.Errorf("index %v: ReadAt past the end = %d, %v, expected 4, EOF", index, n, err)
+		}
+
+		// The sequential reader must skip the index.
+		sequential, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output, err := io.ReadAll(sequential); err != nil || !bytes.Equal(output, input) {
+			t.Errorf("index %v: sequential read failed: %v", index, err)
+		}
+	}
+}
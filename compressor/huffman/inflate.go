@@ -0,0 +1,394 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+)
+
+var errInflate = fmt.Errorf("%w: invalid deflate data", ErrCorrupt)
+
+// inflateHistory is how much earlier output a DEFLATE match may refer to.
+const inflateHistory = deflateWindowSize
+
+// lsbBitReader reads a least-significant-bit-first bitstream one byte at a
+// time, never reading a byte before one of its bits is needed, so whatever
+// follows the DEFLATE stream is left unread.
+type lsbBitReader struct {
+	r     io.ByteReader
+	bits  uint64
+	count uint
+}
+
+func (br *lsbBitReader) readBits(n uint) (uint64, error) {
+	for br.count < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		br.bits |= uint64(b) << br.count
+		br.count += 8
+	}
+	value := br.bits & (1<<n - 1)
+	br.bits >>= n
+	br.count -= n
+	return value, nil
+}
+
+// alignToByte drops the rest of the current byte.
+func (br *lsbBitReader) alignToByte() {
+	br.bits >>= br.count % 8
+	br.count -= br.count % 8
+}
+
+// inflateCode is a canonical Huffman code described by how many codes there
+// are of each length and the symbols in canonical order.
+type inflateCode struct {
+	counts  [deflateMaxCodeLength + 1]int
+	symbols []int
+}
+
+func newInflateCode(lengths []int) (*inflateCode, error) {
+
+	code := &inflateCode{}
+	for _, length := range lengths {
+		code.counts[length]++
+	}
+
+	// Reject over-subscribed codes. Incomplete codes are only allowed for a
+	// single one-bit code.
+	left := 1
+	for length := 1; length <= deflateMaxCodeLength; length++ {
+		left <<= 1
+		left -= code.counts[length]
+		if left < 0 {
+			return nil, fmt.Errorf("%w: over-subscribed code", errInflate)
+		}
+	}
+	used := len(lengths) - code.counts[0]
+	if left > 0 && used > 1 {
+		return nil, fmt.Errorf("%w: incomplete code", errInflate)
+	}
+
+	var offsets [deflateMaxCodeLength + 2]int
+	for length := 1; length <= deflateMaxCodeLength; length++ {
+		offsets[length+1] = offsets[length] + code.counts[length]
+	}
+	code.symbols = make([]int, used)
+	for symbol, length := range lengths {
+		if length > 0 {
+			code.symbols[offsets[length]] = symbol
+			offsets[length]++
+		}
+	}
+
+	return code, nil
+}
+
+// decode reads one symbol, a bit at a time, comparing the code read so far
+// with the first code of each length.
+func (c *inflateCode) decode(br *lsbBitReader) (int, error) {
+	code, first, index := 0, 0, 0
+	for length := 1; length <= deflateMaxCodeLength; length++ {
+		bit, err := br.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := c.counts[length]
+		if code-first < count {
+			return c.symbols[index+code-first], nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, fmt.Errorf("%w: invalid code", errInflate)
+}
+
+var fixedLiteralCode, fixedDistanceCode = func() (*inflateCode, *inflateCode) {
+	lengths := make([]int, 288)
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	literals, _ := newInflateCode(lengths)
+
+	// Distance codes 30 and 31 complete the code but never occur.
+	distances := make([]int, 32)
+	for i := range distances {
+		distances[i] = 5
+	}
+	distanceCode, _ := newInflateCode(distances)
+
+	return literals, distanceCode
+}()
+
+// inflater decompresses a raw DEFLATE stream. Blocks are decoded a window
+// at a time, so a block claiming any amount of output is never held in memory
+// whole.
+type inflater struct {
+	br lsbBitReader
+
+	// out holds recent history followed by output not yet returned.
+	out     []byte
+	pending int
+
+	// The block being decoded, if inBlock: its codes, nil for a stored
+	// block, the bytes of a stored block still to come and the part of a
+	// match not yet copied.
+	inBlock       bool
+	literals      *inflateCode
+	distances     *inflateCode
+	stored        int
+	matchLength   int
+	matchDistance int
+
+	final bool
+	done  bool
+}
+
+func newInflater(r io.ByteReader) *inflater {
+	return &inflater{br: lsbBitReader{r: r}}
+}
+
+func (f *inflater) Read(p []byte) (int, error) {
+	for f.pending == len(f.out) {
+		if f.done {
+			return 0, io.EOF
+		}
+		if err := f.decode(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, f.out[f.pending:])
+	f.pending += n
+
+	return n, nil
+}
+
+// decode adds up to inflateHistory bytes of output to out, starting the
+// next block if the last one has ended. It is only called once all of out
+// has been returned, so history that matches can no longer reach is
+// dropped first.
+func (f *inflater) decode() error {
+
+	if len(f.out) > 2*inflateHistory {
+		kept := copy(f.out, f.out[len(f.out)-inflateHistory:])
+		f.out = f.out[:kept]
+		f.pending = kept
+	}
+
+	if !f.inBlock {
+		if f.final {
+			f.done = true
+			return nil
+		}
+		return f.nextBlock()
+	}
+
+	limit := len(f.out) + inflateHistory
+	if f.literals == nil {
+		return f.storedBlock(limit)
+	}
+	return f.huffmanBlock(limit)
+}
+
+// nextBlock reads the header of the next DEFLATE block, and its codes.
+func (f *inflater) nextBlock() error {
+
+	header, err := f.br.readBits(3)
+	if err != nil {
+		return err
+	}
+	f.final = header&1 == 1
+
+	switch header >> 1 {
+	case 0:
+		f.br.alignToByte()
+		lengths, err := f.br.readBits(32)
+		if err != nil {
+			return err
+		}
+		length, inverse := lengths&0xffff, lengths>>16
+		if length != ^inverse&0xffff {
+			return fmt.Errorf("%w: stored block length mismatch", errInflate)
+		}
+		f.literals, f.distances, f.stored = nil, nil, int(length)
+	case 1:
+		f.literals, f.distances = fixedLiteralCode, fixedDistanceCode
+	case 2:
+		if f.literals, f.distances, err = f.readDynamicCodes(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: reserved block type", errInflate)
+	}
+	f.inBlock = true
+
+	return nil
+}
+
+// storedBlock copies the bytes of a stored block until out reaches limit.
+func (f *inflater) storedBlock(limit int) error {
+
+	for f.stored > 0 && len(f.out) < limit {
+		b, err := f.br.readBits(8)
+		if err != nil {
+			return err
+		}
+		f.out = append(f.out, byte(b))
+		f.stored--
+	}
+	f.inBlock = f.stored > 0
+
+	return nil
+}
+
+func (f *inflater) readDynamicCodes() (*inflateCode, *inflateCode, error) {
+
+	counts, err := f.br.readBits(14)
+	if err != nil {
+		return nil, nil, err
+	}
+	numLiterals := int(counts&0x1f) + 257
+	numDistances := int(counts>>5&0x1f) + 1
+	numCodeLengths := int(counts>>10) + 4
+	if numLiterals > deflateLiteralSymbols || numDistances > deflateDistSymbols {
+		return nil, nil, fmt.Errorf("%w: too many codes", errInflate)
+	}
+
+	codeLengthLengths := make([]int, deflateCodeLenSymbols)
+	for _, symbol := range deflateCodeLenOrder[:numCodeLengths] {
+		length, err := f.br.readBits(3)
+		if err != nil {
+			return nil, nil, err
+		}
+		codeLengthLengths[symbol] = int(length)
+	}
+	codeLengthCode, err := newInflateCode(codeLengthLengths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lengths := make([]int, 0, numLiterals+numDistances)
+	for len(lengths) < numLiterals+numDistances {
+		symbol, err := codeLengthCode.decode(&f.br)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if symbol < 16 {
+			lengths = append(lengths, symbol)
+			continue
+		}
+
+		value, extraBits, base := 0, uint(2), 3
+		switch symbol {
+		case 16:
+			if len(lengths) == 0 {
+				return nil, nil, fmt.Errorf("%w: repeat with no previous length", errInflate)
+			}
+			value = lengths[len(lengths)-1]
+		case 17:
+			extraBits = 3
+		case 18:
+			extraBits, base = 7, 11
+		}
+		extra, err := f.br.readBits(extraBits)
+		if err != nil {
+			return nil, nil, err
+		}
+		run := base + int(extra)
+		if len(lengths)+run > numLiterals+numDistances {
+			return nil, nil, fmt.Errorf("%w: code lengths overflow", errInflate)
+		}
+		for i := 0; i < run; i++ {
+			lengths = append(lengths, value)
+		}
+	}
+
+	if lengths[deflateEndOfBlock] == 0 {
+		return nil, nil, fmt.Errorf("%w: no end-of-block code", errInflate)
+	}
+
+	literals, err := newInflateCode(lengths[:numLiterals])
+	if err != nil {
+		return nil, nil, err
+	}
+	distances, err := newInflateCode(lengths[numLiterals:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return literals, distances, nil
+}
+
+// huffmanBlock decodes symbols until out reaches limit or the block ends. A
+// match cut off at the limit is finished by the next call.
+func (f *inflater) huffmanBlock(limit int) error {
+	for len(f.out) < limit {
+		if f.matchLength > 0 {
+			n := min(f.matchLength, limit-len(f.out))
+			start := len(f.out) - f.matchDistance
+			for i := 0; i < n; i++ {
+				f.out = append(f.out, f.out[start+i])
+			}
+			f.matchLength -= n
+			continue
+		}
+
+		symbol, err := f.literals.decode(&f.br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case symbol < deflateEndOfBlock:
+			f.out = append(f.out, byte(symbol))
+			continue
+		case symbol == deflateEndOfBlock:
+			f.inBlock = false
+			return nil
+		case symbol > 285:
+			return fmt.Errorf("%w: invalid length code", errInflate)
+		}
+
+		lengthCode := symbol - 257
+		extra, err := f.br.readBits(uint(deflateLengthExtra[lengthCode]))
+		if err != nil {
+			return err
+		}
+		length := int(deflateLengthBase[lengthCode]) + int(extra)
+
+		distanceCode, err := f.distances.decode(&f.br)
+		if err != nil {
+			return err
+		}
+		if distanceCode >= deflateDistSymbols {
+			return fmt.Errorf("%w: invalid distance code", errInflate)
+		}
+		base, extraBits := bucketBase(uint32(distanceCode))
+		extra, err = f.br.readBits(extraBits)
+		if err != nil {
+			return err
+		}
+		distance := int(base) + int(extra) + 1
+
+		if distance > len(f.out) {
+			return fmt.Errorf("%w: distance too far back", errInflate)
+		}
+
+		f.matchLength, f.matchDistance = length, distance
+	}
+
+	return nil
+}
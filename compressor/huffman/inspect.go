@@ -0,0 +1,220 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// FileInfo describes the layout of a compressed file, as read by Inspect.
+type FileInfo struct {
+	// Header describes the original file, as far as the file records it.
+	Header
+
+	Format   Format
+	Version  int
+	Method   Method
+	Coder    Coder
+	Alphabet Alphabet
+
+	// Indexed reports whether the file ends with a block index.
+	Indexed bool
+
+	// Size is the length of the original data, and CompressedSize the
+	// length of the file.
+	Size           int64
+	CompressedSize int64
+
+	// Blocks lists the blocks of a FormatNative file in order.
+	Blocks []BlockInfo
+}
+
+// BlockInfo describes one block of a FormatNative file.
+type BlockInfo struct {
+	// Offset is where the block starts in the file, Length the number of
+	// original bytes it holds and BodySize the length of its coded body.
+	// Checksum is the CRC-32 recorded for the block's original data.
+	// Stored reports a block kept uncoded because coding did not shrink it.
+	Offset   int64
+	Length   int
+	BodySize int
+	Checksum uint32
+	Stored   bool
+
+	// Symbols lists the prefix code of a MethodHuffman block coded with
+	// CoderHuffman, in symbol order. It is empty for stored blocks and for
+	// other methods, whose codes are spread over several tables or change
+	// as the block goes.
+	Symbols []SymbolInfo
+}
+
+// SymbolInfo describes one symbol of a block's prefix code.
+type SymbolInfo struct {
+	// Symbol is the coded symbol and Bytes the original bytes it stands
+	// for, which differ for alphabets other than AlphabetByte.
+	Symbol rune
+	Bytes  string
+
+	// Frequency is how often the block uses the symbol, found by decoding
+	// the block. Code is the symbol's canonical code as a string of binary
+	// digits, CodeLength bits long.
+	Frequency  int
+	CodeLength int
+	Code       string
+}
+
+// Inspect reads the layout of the compressed file of the given size read
+// through r. The blocks of a FormatNative file are walked one by one and
+// their prefix codes decoded; a gzip file is decoded to find its size. Either
+// stops with a *LimitError where the data breaks the limits in options.
+func Inspect(r io.ReaderAt, size int64, options ReaderOptions) (*FileInfo, error) {
+
+	var id [2]byte
+	if _, err := r.ReadAt(id[:], 0); err == nil && id[0] == gzipID1 && id[1] == gzipID2 {
+		return inspectGzip(r, size, options)
+	}
+
+	header, err := readFileHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{
+		Header:         header.metadata,
+		Format:         FormatNative,
+		Version:        int(header.version),
+		Method:         header.method,
+		Coder:          header.coder,
+		Alphabet:       header.alphabet,
+		Indexed:        header.flags&flagIndex != 0,
+		CompressedSize: size,
+	}
+
+	offset := header.size()
+	for {
+		section := io.NewSectionReader(r, offset, size-offset)
+
+		h, err := readBlockHeader(section)
+		if err != nil {
+			return nil, err
+		}
+		if h.length == 0 {
+			break
+		}
+		if int64(h.size) > section.Size()-blockHeaderSize {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		if err := options.check(info.Size+int64(h.length), offset+blockHeaderSize+int64(h.size)); err != nil {
+			return nil, err
+		}
+
+		block := BlockInfo{Offset: offset, Length: int(h.length), BodySize: int(h.size), Checksum: h.checksum, Stored: h.flags&blockStored != 0}
+		if header.method == MethodHuffman && header.coder == CoderHuffman && !block.Stored {
+			body := make([]byte, h.size)
+			if _, err := io.ReadFull(section, body); err != nil {
+				return nil, noEOF(err)
+			}
+			if block.Symbols, err = inspectSymbols(body, int(h.length), header.alphabet); err != nil {
+				return nil, &BlockError{Block: len(info.Blocks), Offset: offset, Start: info.Size, Err: bodyError(err)}
+			}
+		}
+
+		info.Blocks = append(info.Blocks, block)
+		info.Size += int64(h.length)
+		offset += blockHeaderSize + int64(h.size)
+	}
+
+	t, err := readTrailer(io.NewSectionReader(r, offset+endMarkerSize, size-offset-endMarkerSize))
+	if err != nil {
+		return nil, err
+	}
+	info.Size = int64(t.size)
+
+	return info, nil
+}
+
+// inspectGzip describes a gzip file, which records no blocks of its own.
+func inspectGzip(r io.ReaderAt, size int64, options ReaderOptions) (*FileInfo, error) {
+
+	reader, err := NewReaderOptions(io.NewSectionReader(r, 0, size), options)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{
+		Header:         reader.Header,
+		Format:         FormatGzip,
+		Size:           n,
+		CompressedSize: size,
+	}, nil
+}
+
+// inspectSymbols reads the prefix code of a MethodHuffman block and counts
+// the symbols of its length original bytes.
+func inspectSymbols(body []byte, length int, alphabet Alphabet) ([]SymbolInfo, error) {
+
+	reader := bytes.NewReader(body)
+
+	var words [][]byte
+	var lengths map[rune]int
+	var err error
+	if alphabet == AlphabetByte {
+		lengths, err = readHeader(reader)
+	} else {
+		words, lengths, err = readWideTable(reader, alphabet)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := newDecodeTable(lengths)
+	if err != nil {
+		return nil, err
+	}
+	bits := bitio.NewReader(reader)
+
+	frequency := make(map[rune]int, len(lengths))
+	var buffer [utf8.UTFMax]byte
+	for n := 0; n < length; {
+		symbol, err := table.decodeOne(bits)
+		if err != nil {
+			return nil, err
+		}
+		expanded := expandSymbol(buffer[:0], symbol, alphabet, words)
+		if len(expanded) == 0 {
+			return nil, fmt.Errorf("%w: symbol %d stands for no bytes", ErrCorrupt, symbol)
+		}
+		frequency[symbol]++
+		n += len(expanded)
+	}
+
+	codes := canonicalCodes(lengths)
+	symbols := make([]SymbolInfo, 0, len(lengths))
+	for _, symbol := range sortedSymbols(lengths) {
+		symbols = append(symbols, SymbolInfo{
+			Symbol:     symbol,
+			Bytes:      string(expandSymbol(buffer[:0], symbol, alphabet, words)),
+			Frequency:  frequency[symbol],
+			CodeLength: lengths[symbol],
+			Code:       codeString(codes[symbol]),
+		})
+	}
+
+	return symbols, nil
+}
+
+// codeString spells code out in binary digits.
+func codeString(code bitio.Code) string {
+	if code.Length == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%0*b", code.Length, code.Bits)
+}
@@ -0,0 +1,84 @@
+package huffman
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	input := bytes.Repeat([]byte("aaaab"), 10)
+	compressed := compressWithHeader(t, input, Header{Name: "input.txt"}, WriterOptions{})
+
+	info, err := Inspect(bytes.NewReader(compressed), int64(len(compressed)), ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "input.txt" || info.Version != int(formatVersion) || info.Size != 50 || info.CompressedSize != int64(len(compressed)) {
+		t.Errorf("Inspect = %+v", info)
+	}
+	if len(info.Blocks) != 1 {
+		t.Fatalf("Inspect found %d blocks, expected 1", len(info.Blocks))
+	}
+
+	expected := []SymbolInfo{
+		{Symbol: 'a', Bytes: "a", Frequency: 40, CodeLength: 1, Code: "0"},
+		{Symbol: 'b', Bytes: "b", Frequency: 10, CodeLength: 1, Code: "1"},
+	}
+	symbols := info.Blocks[0].Symbols
+	if len(symbols) != len(expected) {
+		t.Fatalf("Inspect found symbols %+v, expected %+v", symbols, expected)
+	}
+	for i := range expected {
+		if symbols[i] != expected[i] {
+			t.Errorf("symbol %d is %+v, expected %+v", i, symbols[i], expected[i])
+		}
+	}
+}
+
+// TestInspectCountsSymbols checks that the symbol frequencies of every
+// alphabet account for every byte of each block.
+func TestInspectCountsSymbols(t *testing.T) {
+	input := bytes.Repeat([]byte("héllo wörld, hello again world\n"), 200)
+
+	for _, alphabet := range []Alphabet{AlphabetByte, AlphabetRune, AlphabetWord, AlphabetExtended} {
+		for _, index := range []bool{false, true} {
+			compressed := compressBytes(t, input, WriterOptions{BlockSize: 1000, Alphabet: alphabet, Index: index})
+
+			info, err := Inspect(bytes.NewReader(compressed), int64(len(compressed)), ReaderOptions{})
+			if err != nil {
+				t.Fatalf("%v: %v", alphabet, err)
+			}
+			if info.Size != int64(len(input)) || info.Indexed != index {
+				t.Errorf("%v: Inspect = %+v", alphabet, info)
+			}
+
+			total := 0
+			for _, block := range info.Blocks {
+				covered := 0
+				for _, symbol := range block.Symbols {
+					covered += symbol.Frequency * len(symbol.Bytes)
+				}
+				if covered != block.Length {
+					t.Errorf("%v: block at %d has symbols for %d of its %d bytes", alphabet, block.Offset, covered, block.Length)
+				}
+				total += block.Length
+			}
+			if total != len(input) {
+				t.Errorf("%v: blocks hold %d bytes, expected %d", alphabet, total, len(input))
+			}
+		}
+	}
+}
+
+func TestInspectGzip(t *testing.T) {
+	input := []byte("gzip files are decoded to find their size")
+	compressed := compressBytes(t, input, WriterOptions{Format: FormatGzip})
+
+	info, err := Inspect(bytes.NewReader(compressed), int64(len(compressed)), ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Format != FormatGzip || info.Size != int64(len(input)) || len(info.Blocks) != 0 {
+		t.Errorf("Inspect = %+v", info)
+	}
+}
@@ -0,0 +1,346 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	// DefaultWindowSize is how far back the LZ match finder looks unless
+	// told otherwise.
+	DefaultWindowSize = 1 << 15
+
+	minWindowSize = 1 << 8
+	maxWindowSize = 1 << 24
+
+	minMatchLength = 3
+	maxMatchLength = 258
+
+	// maxChainLength bounds how many earlier positions with the same hash
+	// are tried for each match.
+	maxChainLength = 128
+
+	lzHashBits = 15
+
+	// numLengthCodes and numLiteralLengthSymbols describe the literal/length
+	// alphabet: the 256 byte values followed by one symbol per length code.
+	numLengthCodes          = 16
+	numLiteralLengthSymbols = 256 + numLengthCodes
+)
+
+// The alphabets of an LZ block, in the order they are passed to the coder.
+const (
+	lzLiterals = iota
+	lzDistances
+)
+
+// lzToken is a literal byte when length is zero, and otherwise a copy of
+// length bytes starting distance bytes back.
+type lzToken struct {
+	length   uint16
+	literal  byte
+	distance uint32
+}
+
+// findMatches parses data into literals and matches using hash chains over
+// the last windowSize bytes. It evaluates lazily: a match is deferred by one
+// byte when the next position has a longer one.
+func findMatches(data []byte, windowSize int) []lzToken {
+
+	var head [1 << lzHashBits]int32
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, windowSize)
+	windowMask := windowSize - 1
+
+	hash := func(pos int) uint32 {
+		v := uint32(data[pos])<<16 | uint32(data[pos+1])<<8 | uint32(data[pos+2])
+		return (v * 2654435761) >> (32 - lzHashBits)
+	}
+
+	insert := func(pos int) {
+		if pos+minMatchLength <= len(data) {
+			h := hash(pos)
+			prev[pos&windowMask] = head[h]
+			head[h] = int32(pos)
+		}
+	}
+
+	longestMatch := func(pos int) (int, int) {
+		if pos+minMatchLength > len(data) {
+			return 0, 0
+		}
+
+		bestLength, bestDistance := 0, 0
+		limit := min(maxMatchLength, len(data)-pos)
+
+		candidate := int(head[hash(pos)])
+		for chain := 0; candidate >= 0 && pos-candidate <= windowSize && chain < maxChainLength; chain++ {
+			if data[candidate+bestLength] == data[pos+bestLength] {
+				length := 0
+				for length < limit && data[candidate+length] == data[pos+length] {
+					length++
+				}
+				if length > bestLength {
+					bestLength, bestDistance = length, pos-candidate
+					if length == limit {
+						break
+					}
+				}
+			}
+
+			next := int(prev[candidate&windowMask])
+			if next >= candidate {
+				break
+			}
+			candidate = next
+		}
+
+		if bestLength < minMatchLength {
+			return 0, 0
+		}
+		return bestLength, bestDistance
+	}
+
+	tokens := make([]lzToken, 0, len(data)/2)
+
+	pos := 0
+	length, distance := longestMatch(pos)
+	for pos < len(data) {
+		insert(pos)
+		nextLength, nextDistance := longestMatch(pos + 1)
+
+		if length == 0 || nextLength > length {
+			tokens = append(tokens, lzToken{literal: data[pos]})
+			pos++
+			length, distance = nextLength, nextDistance
+			continue
+		}
+
+		tokens = append(tokens, lzToken{length: uint16(length), distance: uint32(distance)})
+		for i := pos + 1; i < pos+length; i++ {
+			insert(i)
+		}
+		pos += length
+		length, distance = longestMatch(pos)
+	}
+
+	return tokens
+}
+
+// bucket splits v into a code and extra bits in the style of DEFLATE
+// distance codes: values below 4 are their own code, and above that every
+// power of two is split into two codes followed by the remaining low bits.
+func bucket(v uint32) (code uint32, extraBits uint, extra uint32) {
+	if v < 4 {
+		return v, 0, 0
+	}
+	n := uint(bits.Len32(v)) - 1
+	return uint32(2*n) | (v>>(n-1))&1, n - 1, v & (1<<(n-1) - 1)
+}
+
+// bucketBase returns the smallest value with the given code, and the number
+// of extra bits that follow the code.
+func bucketBase(code uint32) (base uint32, extraBits uint) {
+	if code < 4 {
+		return code, 0
+	}
+	n := uint(code / 2)
+	return (2 | code&1) << (n - 1), n - 1
+}
+
+// numDistanceCodes returns the size of the distance alphabet for a window.
+func numDistanceCodes(windowSize int) int {
+	code, _, _ := bucket(uint32(windowSize - 1))
+	return int(code) + 1
+}
+
+// encodeLZBlock codes data as LZ77 tokens whose literal/length and distance
+// symbols are entropy coded with two alphabets, DEFLATE style. The body
+// starts with the size of the distance alphabet, followed by the coder's
+// description of both alphabets.
+func encodeLZBlock(body *bytes.Buffer, data []byte, windowSize int, coder Coder, maxCodeLength int) error {
+
+	tokens := findMatches(data, windowSize)
+
+	literalFrequency := make(map[rune]int)
+	distanceFrequency := make(map[rune]int)
+	for _, token := range tokens {
+		if token.length == 0 {
+			literalFrequency[rune(token.literal)]++
+			continue
+		}
+		lengthCode, _, _ := bucket(uint32(token.length - minMatchLength))
+		literalFrequency[rune(256+lengthCode)]++
+		distanceCode, _, _ := bucket(token.distance - 1)
+		distanceFrequency[rune(distanceCode)]++
+	}
+
+	numDistanceSymbols := numDistanceCodes(windowSize)
+	body.WriteByte(byte(numDistanceSymbols))
+
+	e, err := coder.entropyCoder().newEncoder(body, []alphabet{
+		{size: numLiteralLengthSymbols, frequency: literalFrequency},
+		{size: numDistanceSymbols, frequency: distanceFrequency},
+	}, maxCodeLength)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if token.length == 0 {
+			e.encode(lzLiterals, rune(token.literal))
+			continue
+		}
+
+		lengthCode, extraBits, extra := bucket(uint32(token.length - minMatchLength))
+		e.encode(lzLiterals, rune(256+lengthCode))
+		e.writeBits(uint64(extra), extraBits)
+
+		distanceCode, extraBits, extra := bucket(token.distance - 1)
+		e.encode(lzDistances, rune(distanceCode))
+		e.writeBits(uint64(extra), extraBits)
+	}
+	e.flush()
+
+	return nil
+}
+
+// codeTable returns the canonical codes for a dense alphabet of n symbols.
+func codeTable(lengths map[rune]int, n int) []bitio.Code {
+	codes := make([]bitio.Code, n)
+	symbols, values := canonicalOrder(lengths)
+	for i, symbol := range symbols {
+		codes[symbol] = bitio.Code{Bits: uint64(values[i]), Length: uint(lengths[symbol])}
+	}
+	return codes
+}
+
+// writeCodeLengths writes one length byte for each of the n symbols of a
+// dense alphabet, zero marking an unused symbol. A lone symbol has length
+// zero in lengths and is written as 1 with the high bit set.
+func writeCodeLengths(w *bytes.Buffer, lengths map[rune]int, n int) {
+	for symbol := 0; symbol < n; symbol++ {
+		length, used := lengths[rune(symbol)]
+		if used && length == 0 {
+			length = 0x81
+		}
+		w.WriteByte(byte(length))
+	}
+}
+
+// readCodeLengths reads what writeCodeLengths wrote.
+func readCodeLengths(r io.Reader, n int) (map[rune]int, error) {
+
+	raw := make([]byte, n)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, noEOF(err)
+	}
+
+	lengths := make(map[rune]int)
+	for symbol, length := range raw {
+		switch {
+		case length == 0x81:
+			lengths[rune(symbol)] = 0
+		case length > maxCodeLengthLimit:
+			return nil, fmt.Errorf("%w: code length %d exceeds %d bits", ErrHeader, length, maxCodeLengthLimit)
+		case length > 0:
+			lengths[rune(symbol)] = int(length)
+		}
+	}
+
+	return lengths, nil
+}
+
+// lzBlock decodes a block coded by encodeLZBlock. The whole block is decoded
+// on the first call, since matches refer back to earlier output.
+type lzBlock struct {
+	length  int
+	symbols symbolDecoder
+
+	output []byte
+	err    error
+}
+
+func newLZBlock(body []byte, length int, coder Coder) (*lzBlock, error) {
+
+	if len(body) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	numDistanceSymbols := int(body[0])
+	if numDistanceSymbols == 0 || numDistanceSymbols > numDistanceCodes(maxWindowSize) {
+		return nil, fmt.Errorf("%w: %d distance symbols", ErrCorrupt, numDistanceSymbols)
+	}
+
+	symbols, err := coder.entropyCoder().newDecoder(body[1:], []int{numLiteralLengthSymbols, numDistanceSymbols})
+	if err != nil {
+		return nil, err
+	}
+
+	return &lzBlock{length: length, symbols: symbols}, nil
+}
+
+func (b *lzBlock) decode(p []byte) (int, error) {
+
+	if b.output == nil && b.err == nil {
+		b.output = make([]byte, 0, b.length)
+		b.err = b.decodeAll()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n := copy(p, b.output)
+	b.output = b.output[n:]
+
+	return n, nil
+}
+
+func (b *lzBlock) decodeAll() error {
+
+	for len(b.output) < b.length {
+		symbol, err := b.symbols.decode(lzLiterals)
+		if err != nil {
+			return err
+		}
+
+		if symbol < 256 {
+			b.output = append(b.output, byte(symbol))
+			continue
+		}
+
+		base, extraBits := bucketBase(uint32(symbol - 256))
+		extra, err := b.symbols.readBits(extraBits)
+		if err != nil {
+			return err
+		}
+		length := int(base+uint32(extra)) + minMatchLength
+
+		distanceCode, err := b.symbols.decode(lzDistances)
+		if err != nil {
+			return err
+		}
+		base, extraBits = bucketBase(uint32(distanceCode))
+		extra, err = b.symbols.readBits(extraBits)
+		if err != nil {
+			return err
+		}
+		distance := int(base+uint32(extra)) + 1
+
+		if distance > len(b.output) || length > b.length-len(b.output) {
+			return fmt.Errorf("%w: invalid match of %d bytes at distance %d", ErrCorrupt, length, distance)
+		}
+
+		// Copy byte by byte, since a match may overlap its own output.
+		start := len(b.output) - distance
+		for i := 0; i < length; i++ {
+			b.output = append(b.output, b.output[start+i])
+		}
+	}
+
+	return nil
+}
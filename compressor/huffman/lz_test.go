@@ -0,0 +1,95 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// TestLZRoundTrip round-trips inputs with long, short and overlapping matches
+// under several window sizes.
+func TestLZRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	noise := make([]byte, 5000)
+	random.Read(noise)
+
+	var phrases bytes.Buffer
+	words := []string{"match ", "finder ", "hash ", "chain ", "window ", "literal "}
+	for phrases.Len() < 50000 {
+		phrases.WriteString(words[random.Intn(len(words))])
+	}
+
+	inputs := map[string][]byte{
+		"empty":   {},
+		"short":   []byte("ab"),
+		"run":     bytes.Repeat([]byte("x"), 10000),
+		"period":  bytes.Repeat([]byte("abcabcabd"), 2000),
+		"noise":   noise,
+		"phrases": phrases.Bytes(),
+	}
+
+	for name, input := range inputs {
+		for _, windowSize := range []int{minWindowSize, DefaultWindowSize, maxWindowSize} {
+			compressed := compressBytes(t, input, WriterOptions{Method: MethodLZ, WindowSize: windowSize, BlockSize: 20000})
+
+			reader, err := NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := io.ReadAll(iotestHalfReader{reader})
+			if err != nil {
+				t.Fatalf("%s, window %d: %v", name, windowSize, err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("%s, window %d: round trip mismatch: got %d bytes, expected %d", name, windowSize, len(output), len(input))
+			}
+		}
+	}
+}
+
+// TestLZBeatsHuffmanOnRepeats checks that the LZ front end pays off on text
+// made of repeated phrases.
+func TestLZBeatsHuffmanOnRepeats(t *testing.T) {
+	input := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 2000)
+
+	huffman := compressBytes(t, input, WriterOptions{})
+	lz := compressBytes(t, input, WriterOptions{Method: MethodLZ})
+
+	if len(lz)*10 > len(huffman) {
+		t.Errorf("LZ output is %d bytes, expected well under a tenth of Huffman's %d", len(lz), len(huffman))
+	}
+}
+
+func TestBucket(t *testing.T) {
+	for v := uint32(0); v < 1<<16; v++ {
+		code, extraBits, extra := bucket(v)
+		base, baseExtraBits := bucketBase(code)
+		if baseExtraBits != extraBits || base+extra != v || extra >= 1<<extraBits {
+			t.Fatalf("bucket(%d) = %d, %d, %d does not round trip", v, code, extraBits, extra)
+		}
+	}
+}
+
+// TestLZRejectsDistanceAlphabet checks that a distance alphabet larger than
+// any window needs is rejected, since its codes would have more extra bits
+// than can be read at once.
+func TestLZRejectsDistanceAlphabet(t *testing.T) {
+	for _, size := range []byte{0, byte(numDistanceCodes(maxWindowSize) + 1), 255} {
+		if _, err := newLZBlock([]byte{size, 0, 0}, 10, CoderHuffman); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%d distance symbols: got %v, expected ErrCorrupt", size, err)
+		}
+	}
+}
+
+// iotestHalfReader reads at most half of each buffer, so matches are split
+// across Read calls.
+type iotestHalfReader struct {
+	r io.Reader
+}
+
+func (h iotestHalfReader) Read(p []byte) (int, error) {
+	return h.r.Read(p[:(len(p)+1)/2])
+}
@@ -0,0 +1,71 @@
+package huffman
+
+import (
+	"fmt"
+)
+
+// Method selects how the blocks of a stream are coded. It is recorded in the
+// file header, so a Reader picks the matching decoder by itself.
+type Method uint8
+
+const (
+	// MethodHuffman codes each block with a static Huffman table built from
+	// the block's own symbol counts and stored in front of it.
+	MethodHuffman Method = iota
+
+	// MethodAdaptive codes each block in a single pass with an adaptive
+	// (FGK) Huffman tree that is updated after every symbol, so no table is
+	// stored.
+	MethodAdaptive
+
+	// MethodLZ replaces repeated strings with back-references found by an
+	// LZ77 match finder, then Huffman codes literals, match lengths and
+	// distances with two tables per block, in the manner of DEFLATE.
+	MethodLZ
+
+	// MethodContext codes each byte with a static Huffman table chosen by
+	// the byte before it. The 256 contexts of a block are clustered into a
+	// few tables of similar statistics, stored in front of the block.
+	MethodContext
+
+	// MethodBWT applies the Burrows–Wheeler transform, move-to-front and
+	// zero run-length coding to each block before entropy coding it, in the
+	// manner of bzip2.
+	MethodBWT
+)
+
+var methodNames = map[Method]string{
+	MethodHuffman:  "huffman",
+	MethodAdaptive: "adaptive",
+	MethodLZ:       "lz",
+	MethodContext:  "context",
+	MethodBWT:      "bwt",
+}
+
+func (m Method) String() string {
+	if name, ok := methodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Method(%d)", uint8(m))
+}
+
+// ParseMethod returns the Method with the given name.
+func ParseMethod(name string) (Method, error) {
+	for method, methodName := range methodNames {
+		if methodName == name {
+			return method, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown method %q", name)
+}
+
+func (m Method) valid() bool {
+	_, ok := methodNames[m]
+	return ok
+}
+
+// supportsCoders reports whether blocks of the method can be coded with
+// coders other than CoderHuffman.
+func (m Method) supportsCoders() bool {
+	return m == MethodHuffman || m == MethodLZ || m == MethodBWT
+}
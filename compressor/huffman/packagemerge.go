@@ -0,0 +1,102 @@
+package huffman
+
+import (
+	"sort"
+)
+
+// DefaultMaxCodeLength is the longest code a Writer assigns unless told
+// otherwise.
+const DefaultMaxCodeLength = 15
+
+// maxCodeLengthLimit is the longest code the header format and the decoder
+// accept.
+const maxCodeLengthLimit = 24
+
+// packageMergeItem is either a single symbol (a coin) or a package formed by
+// pairing two cheaper items from the previous level.
+type packageMergeItem struct {
+	weight int
+	leaf   int
+	left   *packageMergeItem
+	right  *packageMergeItem
+}
+
+// limitCodeLengths returns code lengths for frequency that never exceed
+// maxCodeLength. The ordinary Huffman tree is used when it is shallow enough;
+// otherwise optimal limited lengths are found with the package-merge
+// algorithm. The caller must ensure that 1<<maxCodeLength >= len(frequency).
+func limitCodeLengths(frequency map[rune]int, maxCodeLength int) map[rune]int {
+
+	lengths := codeLengths(buildTree(frequency))
+
+	longest := 0
+	for _, length := range lengths {
+		longest = max(longest, length)
+	}
+	if longest <= maxCodeLength {
+		return lengths
+	}
+
+	symbols := sortedSymbols(frequency)
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return frequency[symbols[i]] < frequency[symbols[j]]
+	})
+
+	coins := make([]*packageMergeItem, len(symbols))
+	for i, char := range symbols {
+		coins[i] = &packageMergeItem{weight: frequency[char], leaf: i}
+	}
+
+	var items []*packageMergeItem
+	for level := 0; level < maxCodeLength; level++ {
+		packages := make([]*packageMergeItem, 0, len(items)/2)
+		for i := 0; i+1 < len(items); i += 2 {
+			packages = append(packages, &packageMergeItem{
+				weight: items[i].weight + items[i+1].weight,
+				leaf:   -1,
+				left:   items[i],
+				right:  items[i+1],
+			})
+		}
+		items = mergeItems(coins, packages)
+	}
+
+	// Every time a symbol appears in one of the 2n-2 cheapest items its code
+	// grows by one bit.
+	counts := make([]int, len(symbols))
+	var countLeaves func(item *packageMergeItem)
+	countLeaves = func(item *packageMergeItem) {
+		if item.leaf >= 0 {
+			counts[item.leaf]++
+			return
+		}
+		countLeaves(item.left)
+		countLeaves(item.right)
+	}
+	for _, item := range items[:2*len(symbols)-2] {
+		countLeaves(item)
+	}
+
+	limited := make(map[rune]int, len(symbols))
+	for i, char := range symbols {
+		limited[char] = counts[i]
+	}
+
+	return limited
+}
+
+// mergeItems merges two lists sorted by weight, preferring coins on ties.
+func mergeItems(coins, packages []*packageMergeItem) []*packageMergeItem {
+	merged := make([]*packageMergeItem, 0, len(coins)+len(packages))
+	i, j := 0, 0
+	for i < len(coins) || j < len(packages) {
+		if j == len(packages) || (i < len(coins) && coins[i].weight <= packages[j].weight) {
+			merged = append(merged, coins[i])
+			i++
+		} else {
+			merged = append(merged, packages[j])
+			j++
+		}
+	}
+	return merged
+}
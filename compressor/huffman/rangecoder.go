@@ -0,0 +1,258 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// rangeTop is the smallest range the coder works with. Below it the top
+	// byte of low is settled and gets shifted out.
+	rangeTop = 1 << 24
+
+	// rangeTotalBits bounds the sum of an alphabet's scaled frequencies,
+	// which keeps range/total at eight bits or more.
+	rangeTotalBits = 16
+
+	// rangeRawBits is the most raw bits coded in one step.
+	rangeRawBits = 16
+)
+
+// rangeCoder stores the scaled frequency of every symbol of every alphabet
+// as a uvarint, zero marking an unused symbol, followed by the output of a
+// rangeEncoder.
+type rangeCoder struct{}
+
+// scaleFrequencies returns the frequencies of an alphabet scaled so they sum
+// to at most 1<<rangeTotalBits, keeping every used symbol at one or more.
+func scaleFrequencies(a alphabet) []uint32 {
+
+	total := 0
+	for _, count := range a.frequency {
+		total += count
+	}
+
+	limit := 1<<rangeTotalBits - len(a.frequency)
+
+	scaled := make([]uint32, a.size)
+	for symbol, count := range a.frequency {
+		if total <= 1<<rangeTotalBits {
+			scaled[symbol] = uint32(count)
+		} else {
+			scaled[symbol] = uint32(max(1, count*limit/total))
+		}
+	}
+
+	return scaled
+}
+
+// rangeModel is a static model of one alphabet: each symbol owns the
+// interval [start, start+frequency) of [0, total).
+type rangeModel struct {
+	start     []uint32
+	frequency []uint32
+	total     uint32
+
+	// lookup maps every value below total to the symbol owning it.
+	lookup []uint16
+}
+
+func newRangeModel(frequency []uint32) *rangeModel {
+
+	m := &rangeModel{start: make([]uint32, len(frequency)), frequency: frequency}
+	for symbol, f := range frequency {
+		m.start[symbol] = m.total
+		m.total += f
+	}
+
+	return m
+}
+
+func (m *rangeModel) buildLookup() {
+	m.lookup = make([]uint16, m.total)
+	for symbol, f := range m.frequency {
+		for i := m.start[symbol]; i < m.start[symbol]+f; i++ {
+			m.lookup[i] = uint16(symbol)
+		}
+	}
+}
+
+func (rangeCoder) newEncoder(body *bytes.Buffer, alphabets []alphabet, maxCodeLength int) (symbolEncoder, error) {
+
+	e := &rangeEncoder{w: body, rng: 0xFFFFFFFF, cacheSize: 1, models: make([]*rangeModel, len(alphabets))}
+
+	var buf [binary.MaxVarintLen32]byte
+	for i, a := range alphabets {
+		frequency := scaleFrequencies(a)
+		for _, f := range frequency {
+			body.Write(buf[:binary.PutUvarint(buf[:], uint64(f))])
+		}
+		e.models[i] = newRangeModel(frequency)
+	}
+
+	return e, nil
+}
+
+func (rangeCoder) newDecoder(body []byte, sizes []int) (symbolDecoder, error) {
+
+	reader := bytes.NewReader(body)
+	d := &rangeDecoder{rng: 0xFFFFFFFF, models: make([]*rangeModel, len(sizes))}
+
+	for i, size := range sizes {
+		frequency := make([]uint32, size)
+		total := uint64(0)
+		for symbol := range frequency {
+			f, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, noEOF(err)
+			}
+			total += f
+			if total > 1<<rangeTotalBits {
+				return nil, fmt.Errorf("%w: symbol frequencies exceed %d", ErrHeader, 1<<rangeTotalBits)
+			}
+			frequency[symbol] = uint32(f)
+		}
+
+		d.models[i] = newRangeModel(frequency)
+		d.models[i].buildLookup()
+	}
+
+	d.data = body[len(body)-reader.Len():]
+	for i := 0; i < 5; i++ {
+		d.code = d.code<<8 | uint32(d.nextByte())
+	}
+
+	return d, nil
+}
+
+// rangeEncoder is a byte-oriented range coder in the style of LZMA's: low
+// keeps a carry bit above its 32 bits, and a run of 0xFF bytes is held back
+// in cache and cacheSize until it is known whether the carry reaches it.
+type rangeEncoder struct {
+	w      *bytes.Buffer
+	models []*rangeModel
+
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func (e *rangeEncoder) encode(alphabet int, symbol rune) {
+	m := e.models[alphabet]
+	e.encodeRange(m.start[symbol], m.frequency[symbol], m.total)
+}
+
+// writeBits codes n raw bits, each value being equally likely.
+func (e *rangeEncoder) writeBits(value uint64, n uint) {
+	for n > 0 {
+		step := min(n, rangeRawBits)
+		n -= step
+		e.encodeRange(uint32(value>>n)&(1<<step-1), 1, 1<<step)
+	}
+}
+
+func (e *rangeEncoder) encodeRange(start, size, total uint32) {
+	r := e.rng / total
+	e.low += uint64(start) * uint64(r)
+	e.rng = size * r
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low >= 1<<32 {
+		carry := byte(e.low >> 32)
+		pending := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.w.WriteByte(pending + carry)
+			pending = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+// flush writes out all of low, so that the decoder never reads past the
+// end of the body.
+func (e *rangeEncoder) flush() {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+}
+
+type rangeDecoder struct {
+	data   []byte
+	models []*rangeModel
+
+	code uint32
+	rng  uint32
+
+	// overrun counts bytes asked for past the end of data.
+	overrun int
+}
+
+func (d *rangeDecoder) nextByte() byte {
+	if len(d.data) == 0 {
+		d.overrun++
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *rangeDecoder) decode(alphabet int) (rune, error) {
+	m := d.models[alphabet]
+	if m.total == 0 {
+		return 0, errInvalidCode
+	}
+
+	r := d.rng / m.total
+	value := d.code / r
+	if value >= m.total {
+		return 0, errInvalidCode
+	}
+	symbol := m.lookup[value]
+
+	return rune(symbol), d.consume(m.start[symbol], m.frequency[symbol], r)
+}
+
+func (d *rangeDecoder) readBits(n uint) (uint64, error) {
+	var bits uint64
+	for n > 0 {
+		step := min(n, rangeRawBits)
+		n -= step
+
+		r := d.rng >> step
+		value := d.code / r
+		if value >= 1<<step {
+			return 0, errInvalidCode
+		}
+		if err := d.consume(value, 1, r); err != nil {
+			return 0, err
+		}
+		bits = bits<<step | uint64(value)
+	}
+	return bits, nil
+}
+
+// consume narrows the range to the interval [start, start+size) in units of
+// r, reporting an error once the decoder has run out of input.
+func (d *rangeDecoder) consume(start, size, r uint32) error {
+	d.code -= start * r
+	d.rng = size * r
+	for d.rng < rangeTop {
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(d.nextByte())
+	}
+	if d.overrun > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
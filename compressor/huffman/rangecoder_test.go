@@ -0,0 +1,118 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestRangeCoderRoundTrip round-trips every method that supports the range
+// coder, including raw bits wider than one coding step.
+func TestRangeCoderRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	noise := make([]byte, 50000)
+	random.Read(noise)
+
+	var text bytes.Buffer
+	for text.Len() < 200000 {
+		text.WriteString("    range coding spends fractional bits\n"[:1+random.Intn(40)])
+	}
+
+	inputs := map[string][]byte{
+		"single": []byte("a"),
+		"run":    bytes.Repeat([]byte("z"), 70000),
+		"noise":  noise,
+		"text":   text.Bytes(),
+	}
+
+	for name, input := range inputs {
+		for _, method := range []Method{MethodHuffman, MethodLZ} {
+			options := WriterOptions{Method: method, Coder: CoderRange, BlockSize: 65536, WindowSize: 1 << 20}
+			compressed := compressBytes(t, input, options)
+
+			reader, err := NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.header.coder != CoderRange {
+				t.Errorf("header records coder %v, expected %v", reader.header.coder, CoderRange)
+			}
+
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("%s, %v: %v", name, method, err)
+			}
+			if !bytes.Equal(output, input) {
+				t.Errorf("%s, %v: round trip mismatch: got %d bytes, expected %d", name, method, len(output), len(input))
+			}
+		}
+	}
+}
+
+// TestRangeCoderBeatsHuffmanOnSkew checks that the range coder gets below
+// one bit per symbol on input dominated by a single byte, which no prefix
+// code can.
+func TestRangeCoderBeatsHuffmanOnSkew(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	input := make([]byte, 100000)
+	for i := range input {
+		input[i] = ' '
+		if random.Intn(20) == 0 {
+			input[i] = byte('a' + random.Intn(26))
+		}
+	}
+
+	huffmanSize := len(compressBytes(t, input, WriterOptions{}))
+	rangeSize := len(compressBytes(t, input, WriterOptions{Coder: CoderRange}))
+
+	if rangeSize >= huffmanSize || rangeSize*8 >= len(input) {
+		t.Errorf("range coder wrote %d bytes, huffman %d, for %d input bytes", rangeSize, huffmanSize, len(input))
+	}
+}
+
+func TestRangeCoderTruncated(t *testing.T) {
+	data := []byte("cut off in the middle of the range coded symbols")
+
+	var body bytes.Buffer
+	if err := encodeSymbolBlock(&body, data, CoderRange, DefaultMaxCodeLength); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := newSymbolBlock(body.Bytes()[:body.Len()-8], CoderRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.decode(make([]byte, len(data))); err != io.ErrUnexpectedEOF {
+		t.Errorf("decode error = %v, expected %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestWriterRejectsRangeCoderCombinations(t *testing.T) {
+	// The error names what the coder clashes with, and nothing else.
+	tests := []struct {
+		options  WriterOptions
+		expected string
+	}{
+		{WriterOptions{Method: MethodAdaptive, Coder: CoderRange}, "huffman: the range coder cannot be combined with the adaptive method"},
+		{WriterOptions{Method: MethodContext, Coder: CoderRange}, "huffman: the range coder cannot be combined with the context method"},
+		{WriterOptions{Format: FormatGzip, Coder: CoderRange}, "huffman: the range coder cannot be combined with the gzip format"},
+		{WriterOptions{Coder: Coder(9)}, "huffman: unknown coder"},
+	}
+	for _, test := range tests {
+		_, err := NewWriterOptions(io.Discard, test.options)
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) || strings.Contains(err.Error(), " or ") {
+			t.Errorf("NewWriterOptions(%+v) = %v, expected %q", test.options, err, test.expected)
+		}
+	}
+
+	header := compressBytes(t, nil, WriterOptions{Method: MethodAdaptive})[:fileHeaderSize]
+	header[fileHeaderSize-1] = byte(CoderRange)
+	if _, err := NewReader(bytes.NewReader(header)); !errors.Is(err, ErrHeader) {
+		t.Errorf("NewReader error = %v, expected %v", err, ErrHeader)
+	}
+}
@@ -0,0 +1,182 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"hash/crc32"
+	"io"
+)
+
+// A Range is a span of original data, from Start up to but not including
+// End.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// A Recovery reports what Recover salvaged from a damaged file.
+type Recovery struct {
+	// Size is the length of the original data, as recorded in the trailer,
+	// or the end of the last intact block if the trailer was lost.
+	// SizeKnown reports whether the trailer could be read.
+	Size      int64
+	SizeKnown bool
+
+	// Recovered is the number of original bytes recovered, and Lost lists
+	// the ranges of original data that were not, in order.
+	Recovered int64
+	Lost      []Range
+}
+
+func (rec *Recovery) lose(start, end int64) {
+	if n := len(rec.Lost); n > 0 && rec.Lost[n-1].End == start {
+		rec.Lost[n-1].End = end
+		return
+	}
+	rec.Lost = append(rec.Lost, Range{Start: start, End: end})
+}
+
+// Recover writes the original data of every intact block of the compressed
+// file of the given size, read through r, to w. Past a damaged block it
+// scans for the next block marker, and each block found is checked against
+// its header and data checksums and put back at the offset its header
+// records. With zeroFill the lost ranges are written as zero bytes, so the
+// recovered data keeps its original offsets; otherwise they are left out.
+//
+// Only the file header must be intact, since it says how the blocks are
+// coded. Recover returns an error only if that header cannot be read, w
+// fails, or the data would break the limits in options, counting the zero
+// bytes of lost ranges; damage is reported in the Recovery.
+func Recover(w io.Writer, r io.ReaderAt, size int64, zeroFill bool, options ReaderOptions) (*Recovery, error) {
+
+	header, err := readFileHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recovery{}
+	var written int64
+
+	offset := header.size()
+	for offset < size {
+		h, err := readBlockHeader(io.NewSectionReader(r, offset, size-offset))
+		if err == nil && h.length == 0 {
+			t, err := readTrailer(io.NewSectionReader(r, offset+endMarkerSize, size-offset-endMarkerSize))
+			if err == nil && int64(t.size) >= written {
+				if err := options.check(int64(t.size), size); err != nil {
+					return rec, err
+				}
+				rec.Size, rec.SizeKnown = int64(t.size), true
+				break
+			}
+		}
+		if err != nil || h.length == 0 || int64(h.size) > size-offset-blockHeaderSize {
+			if offset = findBlockMarker(r, offset+1, size); offset < 0 {
+				break
+			}
+			continue
+		}
+		next := offset + blockHeaderSize + int64(h.size)
+
+		// A block from before the data already written cannot be put back.
+		start := int64(h.start)
+		if start < written {
+			offset = next
+			continue
+		}
+
+		if err := options.check(start+int64(h.length), next); err != nil {
+			return rec, err
+		}
+
+		data, err := recoverBlock(r, offset, size, header)
+		if err != nil {
+			offset = next
+			continue
+		}
+
+		if start > written {
+			rec.lose(written, start)
+			if zeroFill {
+				if err := writeZeros(w, start-written); err != nil {
+					return rec, err
+				}
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return rec, err
+		}
+		rec.Recovered += int64(len(data))
+		written = start + int64(len(data))
+		offset = next
+	}
+
+	if !rec.SizeKnown {
+		rec.Size = written
+	}
+	if rec.Size > written {
+		rec.lose(written, rec.Size)
+		if zeroFill {
+			if err := writeZeros(w, rec.Size-written); err != nil {
+				return rec, err
+			}
+		}
+	}
+
+	return rec, nil
+}
+
+// recoverBlock decodes the block at offset, returning its data only if it
+// matches its checksum.
+func recoverBlock(r io.ReaderAt, offset int64, size int64, header fileHeader) ([]byte, error) {
+
+	block, err := readBlock(bufio.NewReader(io.NewSectionReader(r, offset, size-offset)), header)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, block.length)
+	if _, err := block.decode(data); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != block.checksum {
+		return nil, ErrChecksum
+	}
+
+	return data, nil
+}
+
+// findBlockMarker returns the offset of the first block marker at or after
+// offset, or -1 if there is none.
+func findBlockMarker(r io.ReaderAt, offset int64, size int64) int64 {
+
+	chunk := make([]byte, 64<<10)
+	for offset < size {
+		n, err := r.ReadAt(chunk[:min(int64(len(chunk)), size-offset)], offset)
+		if i := bytes.Index(chunk[:n], blockMarker[:]); i >= 0 {
+			return offset + int64(i)
+		}
+		if err != nil && err != io.EOF || n < len(blockMarker) {
+			return -1
+		}
+		// Step back so a marker straddling two chunks is found.
+		offset += int64(n - len(blockMarker) + 1)
+	}
+
+	return -1
+}
+
+func writeZeros(w io.Writer, n int64) error {
+	zeros := make([]byte, min(n, 64<<10))
+	for n > 0 {
+		written, err := w.Write(zeros[:min(n, int64(len(zeros)))])
+		if err != nil {
+			return err
+		}
+		n -= int64(written)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package huffman
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var input []byte
+	for i := 0; len(input) < 8000; i++ {
+		input = append(input, []byte("line of a long log file, number ")...)
+		input = append(input, byte('0'+i%10), '\n')
+	}
+	compressed := compressBytes(t, input, WriterOptions{BlockSize: 1000})
+
+	entries, err := scanBlocks(bytes.NewReader(compressed), fileHeaderSize, int64(len(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Garble the body of block 2 and the marker of block 5, whose data must
+	// then be found by scanning on to block 6.
+	damaged := bytes.Clone(compressed)
+	for i := entries[2].offset + blockHeaderSize; i < entries[3].offset; i += 3 {
+		damaged[i] ^= 0x5a
+	}
+	damaged[entries[5].offset] ^= 0xff
+
+	lost := func(blocks ...int) []Range {
+		var ranges []Range
+		for _, i := range blocks {
+			ranges = append(ranges, Range{Start: entries[i].start, End: entries[i].start + int64(entries[i].length)})
+		}
+		return ranges
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		lost []Range
+		size int64
+	}{
+		{"intact", compressed, nil, int64(len(input))},
+		{"damaged", damaged, lost(2, 5), int64(len(input))},
+		{"truncated", compressed[:entries[7].offset+50], nil, entries[7].start},
+	}
+
+	for _, test := range tests {
+		for _, zeroFill := range []bool{true, false} {
+			var output bytes.Buffer
+			rec, err := Recover(&output, bytes.NewReader(test.data), int64(len(test.data)), zeroFill, ReaderOptions{})
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if !reflect.DeepEqual(rec.Lost, test.lost) || rec.Size != test.size {
+				t.Errorf("%s: lost %v of %d bytes, expected %v of %d", test.name, rec.Lost, rec.Size, test.lost, test.size)
+			}
+
+			// Rebuild what should have been recovered from the input.
+			var expected []byte
+			previous := int64(0)
+			for _, r := range test.lost {
+				expected = append(expected, input[previous:r.Start]...)
+				if zeroFill {
+					expected = append(expected, make([]byte, r.End-r.Start)...)
+				}
+				previous = r.End
+			}
+			expected = append(expected, input[previous:test.size]...)
+
+			if !bytes.Equal(output.Bytes(), expected) {
+				t.Errorf("%s, zero fill %v: recovered %d bytes, not the %d expected", test.name, zeroFill, output.Len(), len(expected))
+			}
+			lostBytes := int64(0)
+			for _, r := range test.lost {
+				lostBytes += r.End - r.Start
+			}
+			if rec.Recovered != test.size-lostBytes {
+				t.Errorf("%s: Recovered = %d, expected %d", test.name, rec.Recovered, test.size-lostBytes)
+			}
+		}
+	}
+}
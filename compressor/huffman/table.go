@@ -0,0 +1,224 @@
+package huffman
+
+import (
+	"compressor/bitio"
+	"fmt"
+	"sort"
+)
+
+var errInvalidCode = fmt.Errorf("%w: invalid code", ErrCorrupt)
+
+// primaryTableBits is the number of bits resolved by the first table probe.
+// Codes no longer than this are decoded with a single lookup; longer codes
+// go through a secondary table.
+const primaryTableBits = 10
+
+// tableEntry is the result of looking up the next bits of the stream.
+// Entries in the primary table may resolve two short codes at once: the
+// first symbol takes firstLength bits and both together take length bits.
+type tableEntry struct {
+	symbols     [2]rune
+	count       uint8
+	firstLength uint8
+	length      uint8
+
+	// link is the index of the secondary table for codes whose first
+	// primaryTableBits bits select this entry, or -1.
+	link int32
+}
+
+type secondaryTable struct {
+	bits    uint
+	entries []tableEntry
+}
+
+// decodeTable is a multi-level lookup table for a canonical Huffman code.
+type decodeTable struct {
+	primaryBits uint
+	maxLength   uint
+	primary     []tableEntry
+	secondary   []secondaryTable
+
+	// single is set when the alphabet has one symbol, which gets the empty
+	// code and so takes no bits at all.
+	single    bool
+	singleSym rune
+}
+
+// canonicalOrder returns the symbols with non-zero code length in canonical
+// order, together with the code assigned to each.
+func canonicalOrder(lengths map[rune]int) ([]rune, []uint32) {
+
+	symbols := make([]rune, 0, len(lengths))
+	for _, char := range sortedSymbols(lengths) {
+		if lengths[char] > 0 {
+			symbols = append(symbols, char)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return lengths[symbols[i]] < lengths[symbols[j]]
+	})
+
+	codes := make([]uint32, len(symbols))
+
+	code := uint32(0)
+	previousLength := 0
+	for i, char := range symbols {
+		code <<= lengths[char] - previousLength
+		previousLength = lengths[char]
+		codes[i] = code
+		code++
+	}
+
+	return symbols, codes
+}
+
+// newDecodeTable builds the lookup tables for the canonical code described
+// by lengths.
+func newDecodeTable(lengths map[rune]int) (*decodeTable, error) {
+
+	if len(lengths) == 1 {
+		for char, length := range lengths {
+			if length == 0 {
+				return &decodeTable{single: true, singleSym: char}, nil
+			}
+		}
+	}
+
+	symbols, codes := canonicalOrder(lengths)
+	if len(symbols) != len(lengths) {
+		return nil, fmt.Errorf("%w: zero code length among several symbols", ErrHeader)
+	}
+
+	// A complete prefix code has Kraft sum exactly one: less leaves bit
+	// patterns that decode to nothing, more gives two symbols one pattern.
+	table := &decodeTable{}
+	kraft := uint64(0)
+	for _, char := range symbols {
+		table.maxLength = max(table.maxLength, uint(lengths[char]))
+		kraft += 1 << (maxCodeLengthLimit - lengths[char])
+	}
+	if kraft != 1<<maxCodeLengthLimit {
+		return nil, fmt.Errorf("%w: code lengths do not form a complete prefix code", ErrHeader)
+	}
+	table.primaryBits = min(table.maxLength, primaryTableBits)
+	table.primary = make([]tableEntry, 1<<table.primaryBits)
+	for i := range table.primary {
+		table.primary[i].link = -1
+	}
+
+	// Size each secondary table for the longest code sharing its prefix.
+	secondaryBits := make(map[uint32]uint)
+	for i, char := range symbols {
+		length := uint(lengths[char])
+		if length > table.primaryBits {
+			prefix := codes[i] >> (length - table.primaryBits)
+			secondaryBits[prefix] = max(secondaryBits[prefix], length-table.primaryBits)
+		}
+	}
+	for _, prefix := range sortedKeys(secondaryBits) {
+		if table.primary[prefix].link >= 0 {
+			continue
+		}
+		table.primary[prefix].link = int32(len(table.secondary))
+		entries := make([]tableEntry, 1<<secondaryBits[prefix])
+		for i := range entries {
+			entries[i].link = -1
+		}
+		table.secondary = append(table.secondary, secondaryTable{
+			bits:    secondaryBits[prefix],
+			entries: entries,
+		})
+	}
+
+	for i, char := range symbols {
+		length := uint(lengths[char])
+		code := codes[i]
+
+		entries, bits := table.primary, table.primaryBits
+		if length > table.primaryBits {
+			sub := &table.secondary[table.primary[code>>(length-table.primaryBits)].link]
+			entries, bits = sub.entries, sub.bits
+			code &= 1<<(length-table.primaryBits) - 1
+			length -= table.primaryBits
+		}
+
+		// A code shorter than the table index fills every slot it prefixes.
+		first := code << (bits - length)
+		for slot := first; slot < first+1<<(bits-length); slot++ {
+			if entries[slot].count != 0 || entries[slot].link >= 0 {
+				return nil, fmt.Errorf("%w: code lengths do not form a prefix code", ErrHeader)
+			}
+			entries[slot] = tableEntry{
+				symbols:     [2]rune{char},
+				count:       1,
+				firstLength: uint8(lengths[char]),
+				length:      uint8(lengths[char]),
+				link:        -1,
+			}
+		}
+	}
+
+	table.pairShortCodes()
+
+	return table, nil
+}
+
+// pairShortCodes extends primary entries whose code leaves enough unused
+// index bits to also resolve the code that follows it.
+func (table *decodeTable) pairShortCodes() {
+
+	singles := make([]tableEntry, len(table.primary))
+	copy(singles, table.primary)
+
+	mask := uint32(len(table.primary) - 1)
+	for slot, entry := range singles {
+		if entry.count != 1 || uint(entry.length) >= table.primaryBits {
+			continue
+		}
+
+		next := singles[(uint32(slot)<<entry.length)&mask]
+		if next.count != 1 || uint(entry.length)+uint(next.length) > table.primaryBits {
+			continue
+		}
+
+		table.primary[slot].symbols[1] = next.symbols[0]
+		table.primary[slot].count = 2
+		table.primary[slot].length = entry.length + next.length
+	}
+}
+
+// decodeOne reads a single symbol from br. Unlike the block decoder it never
+// takes a second symbol from a paired entry, so it can be used on streams
+// where codes are interleaved with other fields.
+func (table *decodeTable) decodeOne(br *bitio.Reader) (rune, error) {
+
+	if table.single {
+		return table.singleSym, nil
+	}
+
+	if br.Buffered() < table.maxLength {
+		br.Fill()
+	}
+
+	entry := &table.primary[br.Peek(table.primaryBits)]
+	if entry.link >= 0 {
+		sub := &table.secondary[entry.link]
+		entry = &sub.entries[br.Peek(table.primaryBits+sub.bits)&(1<<sub.bits-1)]
+	}
+	if entry.count == 0 {
+		return 0, errInvalidCode
+	}
+
+	return entry.symbols[0], br.Consume(uint(entry.firstLength))
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[uint32]V) []uint32 {
+	keys := make([]uint32, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,167 @@
+package huffman
+
+import (
+	"bytes"
+	"compressor/bitio"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// TestDecodeTableLongCodes round-trips data whose codes are long enough to
+// need secondary tables.
+func TestDecodeTableLongCodes(t *testing.T) {
+	var input []byte
+	a, b := 1, 1
+	for char := byte(0); char < 25; char++ {
+		input = append(input, bytes.Repeat([]byte{char}, a)...)
+		a, b = b, a+b
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(input), func(i, j int) {
+		input[i], input[j] = input[j], input[i]
+	})
+
+	compressed := compressBytes(t, input, WriterOptions{MaxCodeLength: maxCodeLengthLimit})
+
+	reader, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := reader.block.decoder.(*staticBlock).table
+	if table.maxLength <= primaryTableBits || len(table.secondary) == 0 {
+		t.Fatalf("expected codes longer than %d bits, longest is %d", primaryTableBits, table.maxLength)
+	}
+	if !bytes.Equal(output, input) {
+		t.Errorf("round trip mismatch: got %d bytes, expected %d", len(output), len(input))
+	}
+}
+
+func compressBytes(tb testing.TB, input []byte, options WriterOptions) []byte {
+	var compressed bytes.Buffer
+	writer, err := NewWriterOptions(&compressed, options)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := writer.Write(input); err != nil {
+		tb.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+// benchmarkInput returns about a megabyte of word-like text with a skewed
+// symbol distribution.
+func benchmarkInput() []byte {
+	words := []string{"the", "huffman", "decoder", "reads", "a", "table", "of", "codes", "and", "writes", "bytes", "quickly", "\n"}
+	random := rand.New(rand.NewSource(1))
+
+	var input bytes.Buffer
+	for input.Len() < 1<<20 {
+		input.WriteString(words[random.Intn(len(words))])
+		input.WriteByte(' ')
+	}
+	return input.Bytes()
+}
+
+// BenchmarkDecodeTable measures the table-driven Reader.
+func BenchmarkDecodeTable(b *testing.B) {
+	input := benchmarkInput()
+	compressed := compressBytes(b, input, WriterOptions{})
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		reader, err := NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeBitByBit measures walking the Huffman tree one bit at a
+// time, the approach the table-driven decoder replaces.
+func BenchmarkDecodeBitByBit(b *testing.B) {
+	input := benchmarkInput()
+	compressed := bytes.NewReader(compressBytes(b, input, WriterOptions{BlockSize: 2 * len(input)}))
+
+	if _, err := readFileHeader(compressed); err != nil {
+		b.Fatal(err)
+	}
+	h, err := readBlockHeader(compressed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	body := io.LimitReader(compressed, int64(h.size))
+	lengths, err := readHeader(body)
+	if err != nil {
+		b.Fatal(err)
+	}
+	payload, _ := io.ReadAll(body)
+	headNode := rebuildTree(canonicalCodes(lengths))
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		output := make([]byte, 0, len(input))
+		node := headNode
+		for _, currentByte := range payload {
+			for bitIndex := 7; bitIndex >= 0 && len(output) < len(input); bitIndex-- {
+				if currentByte&(1<<bitIndex) != 0 {
+					node = node.right
+				} else {
+					node = node.left
+				}
+				if node.isLeaf {
+					output = append(output, byte(node.element))
+					node = headNode
+				}
+			}
+		}
+		if len(output) != len(input) {
+			b.Fatalf("decoded %d bytes, expected %d", len(output), len(input))
+		}
+	}
+}
+
+func rebuildTree(prefixTable map[rune]bitio.Code) *huffmanNode {
+	if len(prefixTable) == 0 {
+		return nil
+	}
+
+	headNode := &huffmanNode{}
+
+	for char, code := range prefixTable {
+		node := headNode
+		for i := int(code.Length) - 1; i >= 0; i-- {
+			if node.isLeaf {
+				return nil
+			}
+			if code.Bits>>i&1 == 1 {
+				if node.right == nil {
+					node.right = &huffmanNode{}
+				}
+				node = node.right
+			} else {
+				if node.left == nil {
+					node.left = &huffmanNode{}
+				}
+				node = node.left
+			}
+		}
+		node.isLeaf = true
+		node.element = char
+	}
+
+	return headNode
+}
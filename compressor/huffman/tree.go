@@ -1,7 +1,9 @@
 package huffman
 
 import (
+	"compressor/bitio"
 	"container/heap"
+	"sort"
 )
 
 type huffmanNode struct {
@@ -32,17 +34,15 @@ func (h *queue) Pop() any {
 	return x
 }
 
-var (
-	internalPrefixTable map[rune]string
-)
-
 func buildTree(frequency map[rune]int) *huffmanNode {
 
 	huffmanQueue := &queue{}
 	heap.Init(huffmanQueue)
 
-	for char, freq := range frequency {
-		heap.Push(huffmanQueue, huffmanNode{freq, char, true, nil, nil})
+	// Push symbols in a fixed order so that ties between equal weights are
+	// broken the same way on every run, whatever the map iteration order.
+	for _, char := range sortedSymbols(frequency) {
+		heap.Push(huffmanQueue, huffmanNode{frequency[char], char, true, nil, nil})
 	}
 
 	for huffmanQueue.Len() > 1 {
@@ -60,21 +60,61 @@ func buildTree(frequency map[rune]int) *huffmanNode {
 	return nil
 }
 
-func constructTable(headNode *huffmanNode) map[rune]string {
-	internalPrefixTable = make(map[rune]string)
-	traverseTree(headNode, "")
-	return internalPrefixTable
+func constructTable(headNode *huffmanNode) map[rune]bitio.Code {
+	prefixTable := make(map[rune]bitio.Code)
+	traverseTree(prefixTable, headNode, bitio.Code{})
+	return prefixTable
 }
 
-func traverseTree(node *huffmanNode, prefix string) {
+func traverseTree(prefixTable map[rune]bitio.Code, node *huffmanNode, prefix bitio.Code) {
 	if node == nil {
 		return
 	}
 
 	if node.isLeaf {
-		internalPrefixTable[node.element] = prefix
+		prefixTable[node.element] = prefix
 		return
 	}
-	traverseTree(node.left, prefix+"0")
-	traverseTree(node.right, prefix+"1")
+	traverseTree(prefixTable, node.left, bitio.Code{Bits: prefix.Bits << 1, Length: prefix.Length + 1})
+	traverseTree(prefixTable, node.right, bitio.Code{Bits: prefix.Bits<<1 | 1, Length: prefix.Length + 1})
+}
+
+// codeLengths returns the depth of every leaf in the tree, which is all a
+// canonical code needs.
+func codeLengths(headNode *huffmanNode) map[rune]int {
+	lengths := make(map[rune]int)
+	for char, code := range constructTable(headNode) {
+		lengths[char] = int(code.Length)
+	}
+	return lengths
+}
+
+// canonicalCodes assigns canonical Huffman codes from code lengths: symbols
+// are ordered by length and then by value, and each gets the next code of its
+// length. The decoder can rebuild the same codes from the lengths alone.
+func canonicalCodes(lengths map[rune]int) map[rune]bitio.Code {
+
+	prefixTable := make(map[rune]bitio.Code, len(lengths))
+	for char, length := range lengths {
+		if length == 0 {
+			prefixTable[char] = bitio.Code{}
+		}
+	}
+
+	symbols, codes := canonicalOrder(lengths)
+	for i, char := range symbols {
+		prefixTable[char] = bitio.Code{Bits: uint64(codes[i]), Length: uint(lengths[char])}
+	}
+
+	return prefixTable
+}
+
+// sortedSymbols returns the keys of a symbol map in ascending order.
+func sortedSymbols[V any](symbols map[rune]V) []rune {
+	keys := make([]rune, 0, len(symbols))
+	for char := range symbols {
+		keys = append(keys, char)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
 }